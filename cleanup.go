@@ -0,0 +1,212 @@
+package go_test_redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Cleanup removes all data from the database leased by WithRedis when test
+// is finished. cli is connected to the leased database db.
+type Cleanup func(ctx context.Context, cli *redis.Client, db int) error
+
+// WithCleanup sets the way leased database is cleaned on test exit.
+// CleanupFlush is the default one.
+func WithCleanup(cleanup Cleanup) Option {
+	return func(o *testRedisOptions) {
+		o.cleanup = cleanup
+	}
+}
+
+// WithDebug logs details of database allocation and cleanup.
+func WithDebug() Option {
+	return func(o *testRedisOptions) {
+		o.debug = true
+	}
+}
+
+// CleanupFlush removes all keys with synchronous FLUSHDB. It blocks redis
+// server until all keys are removed.
+func CleanupFlush() Cleanup {
+	return func(ctx context.Context, cli *redis.Client, db int) error {
+		return cli.FlushDB(ctx).Err()
+	}
+}
+
+// CleanupFlushAsync removes all keys with FLUSHDB ASYNC. Keys disappear
+// immediately, memory is freed by redis in background thread.
+func CleanupFlushAsync() Cleanup {
+	return func(ctx context.Context, cli *redis.Client, db int) error {
+		return cli.FlushDBAsync(ctx).Err()
+	}
+}
+
+// CleanupScanUnlink removes keys in batches of batchSize keys using SCAN and
+// UNLINK, so the server is never blocked for long.
+func CleanupScanUnlink(batchSize int) Cleanup {
+	return func(ctx context.Context, cli *redis.Client, db int) error {
+		var cursor uint64
+		for {
+			keys, next, err := cli.Scan(ctx, cursor, "", int64(batchSize)).
+				Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) != 0 {
+				if err = cli.Unlink(ctx, keys...).Err(); err != nil {
+					return err
+				}
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+}
+
+// CleanupSwapDB swaps the leased database with another free clean database
+// using SWAPDB, so the leased one becomes empty instantly. The swapped out
+// data is removed with FLUSHDB ASYNC and the spare database is released
+// again. If there is no free database to swap with, FLUSHDB ASYNC is used
+// on the leased database.
+func CleanupSwapDB() Cleanup {
+	return func(ctx context.Context, cli *redis.Client, db int) (err error) {
+		conn := cli.Conn(ctx)
+		defer func() {
+			err2 := conn.Close()
+			if err2 != nil && err == nil {
+				err = err2
+			}
+		}()
+		env, err := cleanupEnvFromContext(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err = conn.Select(ctx, env.dbs.control).Err(); err != nil {
+			return err
+		}
+
+		value, err := encodeLeaseValue("",
+			fmt.Sprintf("cleanup of database %v", db))
+		if err != nil {
+			return err
+		}
+		spare, err := lockSpareDB(ctx, env.locker, conn, env.dbs, db, value)
+		if err != nil {
+			return err
+		}
+		if spare < 0 {
+			return cli.FlushDBAsync(ctx).Err()
+		}
+
+		if err = conn.SwapDB(ctx, db, spare).Err(); err != nil {
+			return err
+		}
+		if err = conn.Select(ctx, spare).Err(); err != nil {
+			return err
+		}
+		if err = conn.FlushDBAsync(ctx).Err(); err != nil {
+			return err
+		}
+		if err = conn.Select(ctx, env.dbs.control).Err(); err != nil {
+			return err
+		}
+		return unlockDB(ctx, env.locker, spare)
+	}
+}
+
+// lockSpareDB locks free empty test database other than db with lock value.
+// Connection must be selected to the control database and is left selected
+// to it. Returns -1 if there is no such database.
+func lockSpareDB(
+	ctx context.Context, locker Locker, conn *redis.Conn, dbs dbConfig, db int,
+	value string,
+) (int, error) {
+	n, err := getDatabasesNum(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	testDBs, err := dbs.testDatabases(n)
+	if err != nil {
+		return 0, err
+	}
+
+	if sl, ok := locker.(serverLocker); ok {
+		spares := make([]int, 0, len(testDBs))
+		for _, i := range testDBs {
+			if i != db {
+				spares = append(spares, i)
+			}
+		}
+		spare, _, err := sl.lockFreeDB(ctx, spares, value, lockTimeout, nil)
+		if err != nil {
+			return 0, err
+		}
+		if spare < 0 {
+			return -1, nil
+		}
+		err = conn.SAdd(ctx, dbs.namespace.ownedKey(), spare).Err()
+		return spare, err
+	}
+
+	for _, i := range testDBs {
+		if i == db {
+			continue
+		}
+		ok, err := locker.TryLock(ctx, i, value, lockTimeout)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+		if err = conn.Select(ctx, i).Err(); err != nil {
+			return 0, err
+		}
+		size, err := conn.DBSize(ctx).Result()
+		if err != nil {
+			return 0, err
+		}
+		if err = conn.Select(ctx, dbs.control).Err(); err != nil {
+			return 0, err
+		}
+		if size == 0 {
+			err = conn.SAdd(ctx, dbs.namespace.ownedKey(), i).Err()
+			return i, err
+		}
+		if err = locker.Unlock(ctx, i); err != nil {
+			return 0, err
+		}
+	}
+	return -1, nil
+}
+
+// cleanupEnv is configuration of the lease passed to Cleanup in context.
+type cleanupEnv struct {
+	locker Locker
+	dbs    dbConfig
+}
+
+type cleanupEnvKey struct{}
+
+func withCleanupEnv(ctx context.Context, env cleanupEnv) context.Context {
+	return context.WithValue(ctx, cleanupEnvKey{}, env)
+}
+
+// cleanupEnvFromContext returns configuration of the lease. If Cleanup is
+// called outside of WithRedis, databases configuration is taken from
+// environment and locks are kept in redis, conn is used to access them.
+func cleanupEnvFromContext(
+	ctx context.Context, conn *redis.Conn,
+) (cleanupEnv, error) {
+	if env, ok := ctx.Value(cleanupEnvKey{}).(cleanupEnv); ok {
+		return env, nil
+	}
+	dbs, err := dbConfigFromEnv()
+	if err != nil {
+		return cleanupEnv{}, err
+	}
+	return cleanupEnv{locker: newServerConnLocker(conn, dbs), dbs: dbs}, nil
+}
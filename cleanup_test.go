@@ -0,0 +1,78 @@
+package go_test_redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestCleanupStrategies(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cleanup Cleanup
+	}{
+		{"flush", CleanupFlush()},
+		{"flush async", CleanupFlushAsync()},
+		{"scan unlink", CleanupScanUnlink(3)},
+		{"swapdb", CleanupSwapDB()},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			for i := 0; i < 10; i++ {
+				s.DB(3).Set(fmt.Sprintf("key%v", i), "v")
+			}
+			s.DB(5).Set("other", "v")
+
+			cli := redis.NewClient(newRedisOpts(3))
+			defer closeOrFatal(t, cli)
+			err := tc.cleanup(context.Background(), cli, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keys := s.DB(3).Keys(); len(keys) != 0 {
+				t.Fatalf("database is not cleaned: %v", keys)
+			}
+			// other databases are intact
+			if keys := s.DB(5).Keys(); len(keys) != 1 {
+				t.Fatalf("other database is changed: %v", keys)
+			}
+		})
+	}
+}
+
+func TestCleanupSwapDB(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	dbs := dbConfig{control: 0, allowed: []int{3, 4}}
+	locker := NewMemoryLocker()
+	s.DB(3).Set("a", "1")
+
+	cli := redis.NewClient(newRedisOpts(3))
+	defer closeOrFatal(t, cli)
+	cleanupCtx := withCleanupEnv(ctx, cleanupEnv{locker, dbs})
+	if err := CleanupSwapDB()(cleanupCtx, cli, 3); err != nil {
+		t.Fatal(err)
+	}
+	for _, db := range []int{3, 4} {
+		if keys := s.DB(db).Keys(); len(keys) != 0 {
+			t.Fatalf("database %v is not empty: %v", db, keys)
+		}
+	}
+	// spare database was locked for the swap and released after flush
+	ok, err := locker.TryLock(ctx, 4, "v", 0)
+	if err != nil || !ok {
+		t.Fatalf("spare database is still locked: %v, %v", ok, err)
+	}
+
+	// without free spare database the leased one is flushed in place
+	s.DB(3).Set("a", "1")
+	if err := CleanupSwapDB()(cleanupCtx, cli, 3); err != nil {
+		t.Fatal(err)
+	}
+	if keys := s.DB(3).Keys(); len(keys) != 0 {
+		t.Fatalf("database is not flushed: %v", keys)
+	}
+}
@@ -0,0 +1,120 @@
+package go_test_redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ClientInfo describes client connection from CLIENT LIST output.
+type ClientInfo struct {
+	ID   int64  `json:"id"`
+	Addr string `json:"addr"`
+	Name string `json:"name,omitempty"`
+	DB   int    `json:"db"`
+	// Age is total duration of the connection.
+	Age time.Duration `json:"age"`
+	// Idle is idle time of the connection.
+	Idle time.Duration `json:"idle"`
+	// Cmd is the last command played.
+	Cmd string `json:"cmd"`
+	// Subscriptions is number of channel and pattern subscriptions.
+	Subscriptions int `json:"subscriptions,omitempty"`
+}
+
+// listClients returns all clients connected to redis server.
+func listClients(ctx context.Context, cli redis.Cmdable) ([]ClientInfo, error) {
+	r, err := cli.ClientList(ctx).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseClientList(r)
+}
+
+// leaseConnected reports if some connection made by the test holding lease
+// id is still open. Leases of old versions have no id and are never
+// connected.
+func leaseConnected(
+	ctx context.Context, cli redis.Cmdable, id string,
+) (bool, error) {
+	if id == "" {
+		return false, nil
+	}
+	clients, err := listClients(ctx, cli)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range clients {
+		if leaseIDFromClientName(c.Name) == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseClientList parses CLIENT LIST output. Lines that are not client
+// descriptions are skipped.
+func parseClientList(in string) ([]ClientInfo, error) {
+	var clients []ClientInfo
+	for _, ln := range strings.Split(in, "\n") {
+		fields := parseClientLine(ln)
+		if _, ok := fields["id"]; !ok {
+			continue
+		}
+		c, err := clientFromFields(fields)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse client line %q: %w", ln, err)
+		}
+		clients = append(clients, c)
+	}
+	return clients, nil
+}
+
+// parseClientLine splits one line of CLIENT LIST output into key=value
+// fields.
+func parseClientLine(ln string) map[string]string {
+	fields := make(map[string]string)
+	for _, f := range strings.Fields(ln) {
+		idx := strings.IndexRune(f, '=')
+		if idx <= 0 {
+			continue
+		}
+		fields[f[:idx]] = f[idx+1:]
+	}
+	return fields
+}
+
+func clientFromFields(fields map[string]string) (ClientInfo, error) {
+	var c ClientInfo
+	var err error
+	if c.ID, err = strconv.ParseInt(fields["id"], 10, 64); err != nil {
+		return c, err
+	}
+	if c.DB, err = strconv.Atoi(fields["db"]); err != nil {
+		return c, err
+	}
+	intField := func(name string) int {
+		if err != nil {
+			return 0
+		}
+		var i int
+		if v, ok := fields[name]; ok {
+			i, err = strconv.Atoi(v)
+		}
+		return i
+	}
+	c.Age = time.Duration(intField("age")) * time.Second
+	c.Idle = time.Duration(intField("idle")) * time.Second
+	c.Subscriptions = intField("sub") + intField("psub")
+	if err != nil {
+		return c, err
+	}
+	c.Addr = fields["addr"]
+	c.Name = fields["name"]
+	c.Cmd = fields["cmd"]
+	return c, nil
+}
@@ -0,0 +1,46 @@
+package go_test_redis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseClientList(t *testing.T) {
+	in := "id=3 addr=127.0.0.1:52555 laddr=127.0.0.1:6379 fd=8 name= " +
+		"age=855 idle=0 flags=N db=0 sub=0 psub=0 multi=-1 qbuf=26 " +
+		"qbuf-free=32742 obl=0 oll=0 omem=0 events=r cmd=client\n" +
+		"id=4 addr=127.0.0.1:52556 fd=9 name=worker age=12 idle=3 " +
+		"flags=P db=5 sub=2 psub=1 multi=-1 qbuf=0 qbuf-free=0 obl=0 " +
+		"oll=0 omem=0 events=r cmd=subscribe\n"
+	clients, err := parseClientList(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ClientInfo{
+		{
+			ID:   3,
+			Addr: "127.0.0.1:52555",
+			DB:   0,
+			Age:  855 * time.Second,
+			Cmd:  "client",
+		},
+		{
+			ID:            4,
+			Addr:          "127.0.0.1:52556",
+			Name:          "worker",
+			DB:            5,
+			Age:           12 * time.Second,
+			Idle:          3 * time.Second,
+			Cmd:           "subscribe",
+			Subscriptions: 3,
+		},
+	}
+	if !reflect.DeepEqual(clients, want) {
+		t.Fatal(clients)
+	}
+
+	if _, err = parseClientList("id=x db=0"); err == nil {
+		t.Fatal("expected error on invalid client id")
+	}
+}
@@ -0,0 +1,253 @@
+// Command go-test-redis helps to manage redis used by tests in CI pipelines
+// and on developer machines.
+//
+// Usage:
+//
+//	go-test-redis [-addr host:port] <command> [flags]
+//
+// Commands:
+//
+//	wait    wait until redis is ready to be used by tests
+//	status  show locks of test databases
+//	dirty   show quarantined dirty databases
+//	reset   flush and unlock all test databases
+//	mark    mark redis server as a test one
+//
+// Redis address is taken from -addr flag or REDISADDR environment variable.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	go_test_redis "github.com/olomix/go-test-redis"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %v [-addr host:port] <command> [flags]\n\n",
+		os.Args[0])
+	fmt.Fprint(out, `Commands:
+  wait    wait until redis is ready to be used by tests
+  status  show locks of test databases
+  dirty   show quarantined dirty databases
+  reset   flush and unlock all test databases
+  mark    mark redis server as a test one
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	addr := flag.String("addr", "",
+		"redis address, overrides REDISADDR environment variable")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *addr != "" {
+		if err := os.Setenv("REDISADDR", *addr); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+	switch cmd {
+	case "wait":
+		err = waitCmd(args)
+	case "status":
+		err = statusCmd(args)
+	case "dirty":
+		err = dirtyCmd(args)
+	case "reset":
+		err = resetCmd(args)
+	case "mark":
+		err = markCmd(args)
+	default:
+		fmt.Fprintf(flag.CommandLine.Output(), "unknown command: %v\n\n", cmd)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func waitCmd(args []string) error {
+	fs := flag.NewFlagSet("wait", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 5*time.Second,
+		"time to wait for redis")
+	addrs := fs.String("addrs", "",
+		"comma separated list of addresses or redis:// URLs to wait for "+
+			"instead of the default one")
+	checks := fs.String("checks", "",
+		"comma separated list of additional readiness checks: "+
+			"ping, replica, cluster, aof")
+	minVersion := fs.String("min-version", "",
+		"wait for redis of at least this version")
+	modules := fs.String("modules", "",
+		"comma separated list of modules that must be loaded")
+	verbose := fs.Bool("v", false, "log every attempt")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := []go_test_redis.WaitOption{go_test_redis.WithTimeout(*timeout)}
+	if *addrs != "" {
+		opts = append(opts, go_test_redis.WithAddrs(splitList(*addrs)...))
+	}
+	for _, c := range splitList(*checks) {
+		switch c {
+		case "ping":
+			opts = append(opts, go_test_redis.WithChecks(
+				go_test_redis.CheckPing()))
+		case "replica":
+			opts = append(opts, go_test_redis.WithChecks(
+				go_test_redis.CheckReplicaLink()))
+		case "cluster":
+			opts = append(opts, go_test_redis.WithChecks(
+				go_test_redis.CheckClusterState()))
+		case "aof":
+			opts = append(opts, go_test_redis.WithChecks(
+				go_test_redis.CheckAOFRewrite()))
+		default:
+			return fmt.Errorf("unknown check: %v", c)
+		}
+	}
+	if *minVersion != "" {
+		opts = append(opts, go_test_redis.WithChecks(
+			go_test_redis.CheckMinVersion(*minVersion)))
+	}
+	if *modules != "" {
+		opts = append(opts, go_test_redis.WithChecks(
+			go_test_redis.CheckModules(splitList(*modules)...)))
+	}
+	if *verbose {
+		opts = append(opts, go_test_redis.WithLogf(log.Printf))
+	}
+
+	return go_test_redis.WaitForRedis(opts...)
+}
+
+func statusCmd(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	httpAddr := fs.String("http", "",
+		"serve live status page on this address instead of printing it")
+	asJSON := fs.Bool("json", false, "print status as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *httpAddr != "" {
+		log.Printf("serving status page on http://%v/", *httpAddr)
+		return http.ListenAndServe(*httpAddr, go_test_redis.LeasesHandler())
+	}
+
+	leases, err := go_test_redis.ListLeases(context.Background())
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(leases)
+	}
+	if len(leases) == 0 {
+		fmt.Println("no test databases are locked")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DB\tLEASE\tTEST\tHOST\tPID\tSINCE\tTTL\tCLIENTS")
+	for _, l := range leases {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			l.DB, orDash(l.ID), orDash(l.Test), orDash(l.Host), l.PID,
+			l.Since.Local().Format(time.RFC3339),
+			l.TTL.Round(time.Second), len(l.Clients))
+	}
+	return w.Flush()
+}
+
+func dirtyCmd(args []string) error {
+	fs := flag.NewFlagSet("dirty", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print dirty databases as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dirty, err := go_test_redis.ListDirtyDatabases(context.Background())
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(dirty)
+	}
+	if len(dirty) == 0 {
+		fmt.Println("no dirty test databases")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DB\tSINCE\tKEYS\tOWNED\tLAST TEST")
+	for _, d := range dirty {
+		test := "-"
+		if d.Lease != nil {
+			test = orDash(d.Lease.Test)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", d.DB,
+			d.Since.Local().Format(time.RFC3339), d.Keys, d.Owned, test)
+	}
+	return w.Flush()
+}
+
+func resetCmd(args []string) error {
+	fs := flag.NewFlagSet("reset", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return go_test_redis.ResetDatabases(context.Background())
+}
+
+func markCmd(args []string) error {
+	fs := flag.NewFlagSet("mark", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return go_test_redis.MarkTestServer(context.Background())
+}
+
+func splitList(s string) []string {
+	var result []string
+	for _, i := range strings.Split(s, ",") {
+		if i = strings.TrimSpace(i); i != "" {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,79 @@
+package go_test_redis
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var dashboardTmpl = template.Must(template.New("dashboard").Funcs(
+	template.FuncMap{
+		"ago": func(t time.Time) string {
+			return time.Since(t).Round(time.Second).String()
+		},
+		"round": func(d time.Duration) string {
+			return d.Round(time.Second).String()
+		},
+	}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>go-test-redis leases</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Test databases</h1>
+{{if .}}
+<table>
+<tr><th>DB</th><th>Lease</th><th>Test</th><th>Host</th><th>PID</th><th>Held for</th>
+<th>TTL</th><th>Clients</th></tr>
+{{range .}}
+<tr>
+<td>{{.DB}}</td><td>{{.ID}}</td><td>{{.Test}}</td><td>{{.Host}}</td><td>{{.PID}}</td>
+<td>{{ago .Since}}</td><td>{{round .TTL}}</td>
+<td>{{range .Clients}}{{.ID}} {{.Addr}} {{.Name}} cmd={{.Cmd}}<br>{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>No test databases are locked.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// LeasesHandler returns HTTP handler that renders current leases of test
+// databases as HTML page. JSON is returned if requested with format=json
+// query parameter or Accept: application/json header. It is intended for
+// local use, there is no authentication.
+func LeasesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leases, err := ListLeases(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if r.URL.Query().Get("format") == "json" ||
+			strings.Contains(r.Header.Get("Accept"), "application/json") {
+
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(leases); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := dashboardTmpl.Execute(w, leases); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package go_test_redis
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// controlDBEnv is the name of environment variable with the number of
+// control database keeping locks of test databases.
+const controlDBEnv = "REDISTEST_CONTROL_DB"
+
+// databasesEnv is the name of environment variable with the list of
+// databases that may be leased to tests, like "4-15,20".
+const databasesEnv = "REDISTEST_DATABASES"
+
+// dbConfig describes how tests share redis server.
+type dbConfig struct {
+	// namespace of lock keys and notifications
+	namespace namespace
+	// control database keeping locks
+	control int
+	// databases that may be leased to tests, all databases except control
+	// one if nil
+	allowed []int
+}
+
+// WithControlDB sets the database keeping locks of test databases. It is 0
+// by default or the value of REDISTEST_CONTROL_DB environment variable. All
+// tests sharing redis server must use the same control database.
+func WithControlDB(db int) Option {
+	return func(o *testRedisOptions) {
+		o.dbs.control = db
+	}
+}
+
+// WithDatabases restricts databases that may be leased to tests. All
+// databases except control one are used by default. The default may be set
+// with REDISTEST_DATABASES environment variable as comma separated list of
+// databases and ranges, like REDISTEST_DATABASES=4-15,20.
+func WithDatabases(dbs ...int) Option {
+	return func(o *testRedisOptions) {
+		o.dbs.allowed = dbs
+	}
+}
+
+// dbConfigFromEnv returns databases configuration from environment
+// variables.
+func dbConfigFromEnv() (dbConfig, error) {
+	var cfg dbConfig
+	var err error
+	if cfg.namespace, err = namespaceFromEnv(); err != nil {
+		return cfg, err
+	}
+	if v := os.Getenv(controlDBEnv); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("invalid %v: %q", controlDBEnv, v)
+		}
+		cfg.control = n
+	}
+	if v := os.Getenv(databasesEnv); v != "" {
+		dbs, err := parseDatabases(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %v: %w", databasesEnv, err)
+		}
+		cfg.allowed = dbs
+	}
+	return cfg, nil
+}
+
+// parseDatabases parses comma separated list of databases and ranges of
+// databases, like "4-15,20". Returned databases are sorted and unique.
+func parseDatabases(spec string) ([]int, error) {
+	seen := make(map[int]struct{})
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			from, to = part[:i], part[i+1:]
+		}
+		first, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("invalid database %q", part)
+		}
+		last, err := strconv.Atoi(strings.TrimSpace(to))
+		if err != nil || last < first {
+			return nil, fmt.Errorf("invalid range of databases %q", part)
+		}
+		for n := first; n <= last; n++ {
+			seen[n] = struct{}{}
+		}
+	}
+	if len(seen) == 0 {
+		return nil, fmt.Errorf("empty list of databases")
+	}
+
+	dbs := make([]int, 0, len(seen))
+	for n := range seen {
+		dbs = append(dbs, n)
+	}
+	sort.Ints(dbs)
+	return dbs, nil
+}
+
+// testDatabases returns databases that may be leased to tests on server with
+// n databases.
+func (c dbConfig) testDatabases(n int) ([]int, error) {
+	if err := c.namespace.validate(); err != nil {
+		return nil, err
+	}
+	if c.control < 0 || c.control >= n {
+		return nil, fmt.Errorf(
+			"control database %v is out of range, server has %v databases",
+			c.control, n)
+	}
+
+	if c.allowed == nil {
+		dbs := make([]int, 0, n-1)
+		for i := 0; i < n; i++ {
+			if i != c.control {
+				dbs = append(dbs, i)
+			}
+		}
+		if len(dbs) == 0 {
+			return nil, fmt.Errorf("no databases for tests")
+		}
+		return dbs, nil
+	}
+
+	if len(c.allowed) == 0 {
+		return nil, fmt.Errorf("no databases for tests")
+	}
+	for _, db := range c.allowed {
+		if db == c.control {
+			return nil, fmt.Errorf(
+				"control database %v can't be used by tests", db)
+		}
+		if db < 0 || db >= n {
+			return nil, fmt.Errorf(
+				"database %v is out of range, server has %v databases",
+				db, n)
+		}
+	}
+	return c.allowed, nil
+}
@@ -0,0 +1,55 @@
+package go_test_redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDatabases(t *testing.T) {
+	testCases := []struct {
+		spec string
+		dbs  []int
+		err  bool
+	}{
+		{"4-7,20", []int{4, 5, 6, 7, 20}, false},
+		{" 3 , 1-2 ,2", []int{1, 2, 3}, false},
+		{"5", []int{5}, false},
+		{"", nil, true},
+		{"7-4", nil, true},
+		{"a-4", nil, true},
+		{"-1", nil, true},
+	}
+	for _, tc := range testCases {
+		dbs, err := parseDatabases(tc.spec)
+		if (err != nil) != tc.err || !reflect.DeepEqual(dbs, tc.dbs) {
+			t.Errorf("parseDatabases(%q) = %v, %v", tc.spec, dbs, err)
+		}
+	}
+}
+
+func TestTestDatabases(t *testing.T) {
+	dbs, err := dbConfig{control: 2}.testDatabases(4)
+	if err != nil || !reflect.DeepEqual(dbs, []int{0, 1, 3}) {
+		t.Fatal(dbs, err)
+	}
+
+	dbs, err = dbConfig{allowed: []int{4, 5}}.testDatabases(16)
+	if err != nil || !reflect.DeepEqual(dbs, []int{4, 5}) {
+		t.Fatal(dbs, err)
+	}
+
+	invalid := []dbConfig{
+		{control: 16},
+		{control: 0, allowed: []int{0, 1}},
+		{allowed: []int{16}},
+		{allowed: []int{}},
+	}
+	for _, cfg := range invalid {
+		if _, err = cfg.testDatabases(16); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+	if _, err = (dbConfig{}).testDatabases(1); err == nil {
+		t.Error("expected error for single database")
+	}
+}
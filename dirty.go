@@ -0,0 +1,262 @@
+package go_test_redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// dirtyFlushAfterEnv is the name of environment variable with default
+// DirtyPolicy.FlushAfter.
+const dirtyFlushAfterEnv = "REDISTEST_DIRTY_FLUSH_AFTER"
+
+// dirtyFlushLeasedEnv is the name of environment variable with default
+// DirtyPolicy.FlushLeased.
+const dirtyFlushLeasedEnv = "REDISTEST_DIRTY_FLUSH_LEASED"
+
+// DirtyPolicy decides what happens with databases that are not locked, but
+// contain data. Such databases are quarantined: they are marked with
+// redis-test-dirty-N key in the control database and skipped by tests until
+// somebody flushes them. With default policy quarantined databases are
+// never flushed automatically.
+type DirtyPolicy struct {
+	// FlushAfter flushes database quarantined for this long. Zero disables
+	// flushing by age.
+	FlushAfter time.Duration
+	// FlushLeased flushes dirty database at once if it was leased to a test
+	// and was not cleaned after it, like when test process was killed.
+	FlushLeased bool
+}
+
+// WithDirtyPolicy sets the policy of dirty databases. The default policy
+// may be set with REDISTEST_DIRTY_FLUSH_AFTER (duration) and
+// REDISTEST_DIRTY_FLUSH_LEASED (boolean) environment variables.
+func WithDirtyPolicy(p DirtyPolicy) Option {
+	return func(o *testRedisOptions) {
+		o.dirtyPolicy = p
+	}
+}
+
+// dirtyPolicyFromEnv returns policy of dirty databases from environment
+// variables.
+func dirtyPolicyFromEnv() (DirtyPolicy, error) {
+	var p DirtyPolicy
+	if v := os.Getenv(dirtyFlushAfterEnv); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid %v: %w", dirtyFlushAfterEnv, err)
+		}
+		p.FlushAfter = d
+	}
+	if v := os.Getenv(dirtyFlushLeasedEnv); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid %v: %w", dirtyFlushLeasedEnv, err)
+		}
+		p.FlushLeased = b
+	}
+	return p, nil
+}
+
+// DirtyDB describes quarantined database.
+type DirtyDB struct {
+	DB int `json:"db"`
+	// Since is the time the database was found dirty first.
+	Since time.Time `json:"since"`
+	// Keys is the number of keys when the database was found dirty.
+	Keys int64 `json:"keys"`
+	// Lease is the last lease of the database if the test did not clean it.
+	Lease *Lease `json:"lease,omitempty"`
+	// Owned is true if the database was used by tests before, so its data
+	// may be flushed automatically. Data of databases not owned by tests is
+	// never flushed.
+	Owned bool `json:"owned"`
+}
+
+type dirtyMarker struct {
+	Since time.Time `json:"since"`
+	Keys  int64     `json:"keys"`
+}
+
+// repairDirtyDB quarantines dirty database db locked by us and flushes it if
+// the policy allows and the database is owned by tests. Connection must be
+// selected to the control database and is left selected to it. Returns true
+// if the database was flushed.
+func repairDirtyDB(
+	ctx context.Context, t testing.TB, conn *redis.Conn, dbs dbConfig,
+	policy DirtyPolicy, db int,
+) (bool, error) {
+	ns := dbs.namespace
+	if err := conn.Select(ctx, db).Err(); err != nil {
+		return false, err
+	}
+	size, err := conn.DBSize(ctx).Result()
+	if err != nil {
+		return false, err
+	}
+	if err = conn.Select(ctx, dbs.control).Err(); err != nil {
+		return false, err
+	}
+
+	marker := dirtyMarker{Since: time.Now().UTC().Truncate(time.Second),
+		Keys: size}
+	v, err := json.Marshal(marker)
+	if err != nil {
+		return false, err
+	}
+	isNew, err := conn.SetNX(ctx, ns.dirtyKey(db), v, 0).Result()
+	if err != nil {
+		return false, err
+	}
+	if !isNew {
+		if marker, err = getDirtyMarker(ctx, conn, ns, db); err != nil {
+			return false, err
+		}
+	}
+
+	owned, err := conn.SIsMember(ctx, ns.ownedKey(), db).Result()
+	if err != nil {
+		return false, err
+	}
+	if !owned {
+		if isNew {
+			t.Logf("redis database %v contains data (%v keys) not "+
+				"created by tests and is quarantined, it is never "+
+				"flushed automatically", db, size)
+		}
+		return false, nil
+	}
+
+	var reason string
+	var lease *Lease
+	leased, err := conn.Get(ctx, ns.leasedKey(db)).Result()
+	if err == nil {
+		l, err := parseLeaseValue(db, leased)
+		if err != nil {
+			return false, err
+		}
+		lease = &l
+	} else if err != redis.Nil {
+		return false, err
+	}
+	if policy.FlushLeased && lease != nil {
+		reason = fmt.Sprintf("it was not cleaned after test %v", lease.Test)
+	} else if policy.FlushAfter > 0 &&
+		time.Since(marker.Since) >= policy.FlushAfter {
+
+		reason = fmt.Sprintf("it is dirty since %v",
+			marker.Since.Local().Format(time.RFC3339))
+	}
+
+	if reason == "" {
+		if isNew {
+			t.Logf("redis database %v is not empty (%v keys) and is "+
+				"quarantined", db, size)
+		}
+		return false, nil
+	}
+
+	// the test may still be running if it lost its lock
+	if lease != nil {
+		connected, err := leaseConnected(ctx, conn, lease.ID)
+		if err != nil {
+			return false, err
+		}
+		if connected {
+			t.Logf("redis database %v is dirty, but test %v that leased "+
+				"it is still connected, it is not flushed", db, lease.Test)
+			return false, nil
+		}
+	}
+
+	if err = flushDB(ctx, conn, dbs.control, db); err != nil {
+		return false, err
+	}
+	err = conn.Del(ctx, ns.dirtyKey(db), ns.leasedKey(db)).Err()
+	if err != nil {
+		return false, err
+	}
+	t.Logf("flushed dirty redis database %v (%v keys): %v",
+		db, marker.Keys, reason)
+	return true, nil
+}
+
+func getDirtyMarker(
+	ctx context.Context, cli redis.Cmdable, ns namespace, db int,
+) (dirtyMarker, error) {
+	var marker dirtyMarker
+	v, err := cli.Get(ctx, ns.dirtyKey(db)).Result()
+	if err != nil {
+		return marker, err
+	}
+	if err = json.Unmarshal([]byte(v), &marker); err != nil {
+		return marker, fmt.Errorf(
+			"can't parse quarantine marker of database %v: %w", db, err)
+	}
+	return marker, nil
+}
+
+// ListDirtyDatabases returns quarantined databases ordered by database
+// number. Redis address is taken from REDISADDR environment variable.
+func ListDirtyDatabases(ctx context.Context) (dirty []DirtyDB, err error) {
+	dbs, err := dbConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	cli := redis.NewClient(withClientName(newRedisOpts(dbs.control),
+		clientNamePrefix+":"+clientKindControl))
+	defer func() {
+		err2 := cli.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	ns := dbs.namespace
+	var nums []int
+	iter := cli.Scan(ctx, 0, ns.dirtyKeyPattern(), 100).Iterator()
+	for iter.Next(ctx) {
+		if n, ok := ns.parseDirtyKey(iter.Val()); ok {
+			nums = append(nums, n)
+		}
+	}
+	if err = iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.Ints(nums)
+
+	for _, n := range nums {
+		marker, err := getDirtyMarker(ctx, cli, ns, n)
+		if err == redis.Nil {
+			// database was repaired while we were scanning
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		d := DirtyDB{DB: n, Since: marker.Since, Keys: marker.Keys}
+		d.Owned, err = cli.SIsMember(ctx, ns.ownedKey(), n).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := cli.Get(ctx, ns.leasedKey(n)).Result()
+		if err == nil {
+			l, err := parseLeaseValue(n, v)
+			if err != nil {
+				return nil, err
+			}
+			d.Lease = &l
+		} else if err != redis.Nil {
+			return nil, err
+		}
+		dirty = append(dirty, d)
+	}
+	return dirty, nil
+}
@@ -0,0 +1,70 @@
+package go_test_redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestRepairDirtyDBLeaseConnected(t *testing.T) {
+	newTestServer(t)
+	ctx := context.Background()
+	ctl := redis.NewClient(newRedisOpts(0))
+	defer closeOrFatal(t, ctl)
+	dbs := dbConfig{}
+	ns := dbs.namespace
+	policy := DirtyPolicy{FlushLeased: true}
+
+	// test that lost its lock is still running
+	leased := redis.NewClient(withClientName(newRedisOpts(3),
+		leaseClientName(clientKindLease, "abc", t.Name())))
+	if err := leased.Set(ctx, "k", "v", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	value, err := encodeLeaseValue("abc", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ctl.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.SAdd(ctx, ns.ownedKey(), 3)
+		p.Set(ctx, ns.leasedKey(3), value, 0)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repair := func() bool {
+		t.Helper()
+		conn := ctl.Conn(ctx)
+		defer closeOrFatal(t, conn)
+		flushed, err := repairDirtyDB(ctx, t, conn, dbs, policy, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return flushed
+	}
+	if repair() {
+		t.Fatal("database of connected test is flushed")
+	}
+	if n, err := leased.DBSize(ctx).Result(); err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+
+	closeOrFatal(t, leased)
+	waitFor(t, "test disconnected", func() bool {
+		connected, err := leaseConnected(ctx, ctl, "abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return !connected
+	})
+	if !repair() {
+		t.Fatal("database of finished test is not flushed")
+	}
+	n, err := ctl.Exists(ctx, ns.dirtyKey(3), ns.leasedKey(3)).Result()
+	if err != nil || n != 0 {
+		t.Fatal(n, err)
+	}
+}
@@ -0,0 +1,154 @@
+package go_test_redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// dumpDirEnv is the name of environment variable with default directory for
+// WithDumpOnFailure option.
+const dumpDirEnv = "REDISTEST_DUMP_DIR"
+
+// WithDumpOnFailure writes content of the database of failed test as JSON
+// file into dir, so it may be uploaded as CI artifact. The file is named
+// after the test name and the lease ID. The default directory may be set with
+// REDISTEST_DUMP_DIR environment variable. Empty dir disables dumping.
+func WithDumpOnFailure(dir string) Option {
+	return func(o *testRedisOptions) {
+		o.dumpDir = dir
+	}
+}
+
+// DBDump is the content of the database written by WithDumpOnFailure option.
+type DBDump struct {
+	Test string    `json:"test"`
+	DB   int       `json:"db"`
+	Time time.Time `json:"time"`
+	Keys []KeyDump `json:"keys"`
+}
+
+// KeyDump is one key of DBDump. Value depends on type of the key: string for
+// strings, list of strings for lists and sets, map for hashes, list of
+// redis.Z for sorted sets and list of redis.XMessage for streams. Values of
+// other types (modules) are not dumped.
+type KeyDump struct {
+	Key  string      `json:"key"`
+	Type string      `json:"type"`
+	TTL  int64       `json:"ttl_ms"`
+	Val  interface{} `json:"value"`
+}
+
+var dumpFileNameRe = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// dumpFileName returns file name for the dump of test database. Different
+// test names may be sanitized to the same string, so unique lease ID is a
+// part of the name.
+func dumpFileName(testName, leaseID string) string {
+	return dumpFileNameRe.ReplaceAllString(testName, "_") + "." + leaseID +
+		".redis.json"
+}
+
+// dumpOnFailure writes content of db leased with leaseID into dir.
+func dumpOnFailure(
+	ctx context.Context, t testing.TB, cli *redis.Client, dir string, db int,
+	leaseID string,
+) {
+	dump, err := dumpDB(ctx, cli)
+	if err != nil {
+		t.Errorf("can't dump redis database %v: %v", db, err)
+		return
+	}
+	dump.Test, dump.DB = t.Name(), db
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		t.Errorf("can't create dump directory: %v", err)
+		return
+	}
+	path := filepath.Join(dir, dumpFileName(t.Name(), leaseID))
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		t.Errorf("can't encode dump of redis database %v: %v", db, err)
+		return
+	}
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Errorf("can't write dump of redis database %v: %v", db, err)
+		return
+	}
+	t.Logf("redis database %v is dumped to %v", db, path)
+}
+
+// dumpDB reads all keys with values and TTLs from database cli connected to.
+func dumpDB(ctx context.Context, cli *redis.Client) (DBDump, error) {
+	dump := DBDump{Time: time.Now(), Keys: []KeyDump{}}
+
+	var keys []string
+	iter := cli.Scan(ctx, 0, "", 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return dump, err
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		k, err := dumpKey(ctx, cli, key)
+		if err == redis.Nil {
+			// key expired while we were dumping
+			continue
+		} else if err != nil {
+			return dump, fmt.Errorf("key %q: %w", key, err)
+		}
+		dump.Keys = append(dump.Keys, k)
+	}
+	return dump, nil
+}
+
+func dumpKey(
+	ctx context.Context, cli *redis.Client, key string,
+) (KeyDump, error) {
+	k := KeyDump{Key: key}
+	var err error
+	if k.Type, err = cli.Type(ctx, key).Result(); err != nil {
+		return k, err
+	}
+	ttl, err := cli.PTTL(ctx, key).Result()
+	if err != nil {
+		return k, err
+	}
+	k.TTL = ttl.Milliseconds()
+	if ttl < 0 {
+		k.TTL = -1
+	}
+
+	switch k.Type {
+	case "none":
+		return k, redis.Nil
+	case "string":
+		k.Val, err = cli.Get(ctx, key).Result()
+	case "list":
+		k.Val, err = cli.LRange(ctx, key, 0, -1).Result()
+	case "set":
+		var members []string
+		members, err = cli.SMembers(ctx, key).Result()
+		sort.Strings(members)
+		k.Val = members
+	case "zset":
+		k.Val, err = cli.ZRangeWithScores(ctx, key, 0, -1).Result()
+	case "hash":
+		k.Val, err = cli.HGetAll(ctx, key).Result()
+	case "stream":
+		k.Val, err = cli.XRange(ctx, key, "-", "+").Result()
+	}
+	return k, err
+}
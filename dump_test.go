@@ -0,0 +1,126 @@
+package go_test_redis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestDumpFileName(t *testing.T) {
+	testCases := []struct {
+		testName string
+		want     string
+	}{
+		{"TestCache", "TestCache.abc.redis.json"},
+		{"TestCache/sub_test", "TestCache_sub_test.abc.redis.json"},
+		{
+			"TestCache/with spaces & symbols",
+			"TestCache_with_spaces_symbols.abc.redis.json",
+		},
+		{"TestCache/../etc", "TestCache_.._etc.abc.redis.json"},
+	}
+	for _, tc := range testCases {
+		if got := dumpFileName(tc.testName, "abc"); got != tc.want {
+			t.Errorf("dumpFileName(%q) = %q, want %q",
+				tc.testName, got, tc.want)
+		}
+	}
+
+	// names sanitized to the same string do not overwrite each other
+	first, second := dumpFileName("a b", newLeaseID()),
+		dumpFileName("a_b", newLeaseID())
+	if first == second {
+		t.Fatal("dumps of different tests have the same name")
+	}
+}
+
+func TestDumpOnFailure(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	cli := redis.NewClient(newRedisOpts(1))
+	defer closeOrFatal(t, cli)
+
+	db := s.DB(1)
+	if err := db.Set("str", "v"); err != nil {
+		t.Fatal(err)
+	}
+	db.SetTTL("str", time.Minute)
+	if _, err := db.Push("list", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SetAdd("set", "y", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ZAdd("zset", 1.5, "m"); err != nil {
+		t.Fatal(err)
+	}
+	db.HSet("hash", "f", "v")
+	_, err := db.XAdd("stream", "1-1", []string{"f", "v"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	dumpOnFailure(ctx, t, cli, dir, 1, "abc")
+	data, err := ioutil.ReadFile(
+		filepath.Join(dir, dumpFileName(t.Name(), "abc")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dump struct {
+		Test string
+		DB   int
+		Keys []struct {
+			Key  string
+			Type string
+			TTL  int64           `json:"ttl_ms"`
+			Val  json.RawMessage `json:"value"`
+		}
+	}
+	if err = json.Unmarshal(data, &dump); err != nil {
+		t.Fatal(err)
+	}
+	if dump.Test != t.Name() || dump.DB != 1 {
+		t.Fatalf("%v %v", dump.Test, dump.DB)
+	}
+
+	want := []struct {
+		key, typ string
+		ttl      int64
+		val      string
+	}{
+		{"hash", "hash", -1, `{"f":"v"}`},
+		{"list", "list", -1, `["a","b"]`},
+		{"set", "set", -1, `["x","y"]`},
+		{"str", "string", 60000, `"v"`},
+		{"stream", "stream", -1, `[{"ID":"1-1","Values":{"f":"v"}}]`},
+		{"zset", "zset", -1, `[{"Score":1.5,"Member":"m"}]`},
+	}
+	if len(dump.Keys) != len(want) {
+		t.Fatalf("%s", data)
+	}
+	for i, w := range want {
+		k := dump.Keys[i]
+		var val bytes.Buffer
+		if err = json.Compact(&val, k.Val); err != nil {
+			t.Fatal(err)
+		}
+		if k.Key != w.key || k.Type != w.typ || k.TTL != w.ttl ||
+			val.String() != w.val {
+
+			t.Errorf("key %v: %v %v %s, want %v %v %v", w.key, k.Type,
+				k.TTL, val.String(), w.typ, w.ttl, w.val)
+		}
+	}
+
+	// key expired while the database was dumped
+	if _, err = dumpKey(ctx, cli, "missing"); err != redis.Nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,107 @@
+package go_test_redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultForbiddenCommands are commands that break isolation of tests
+// sharing the server or block it for long. Use them with
+// WithForbiddenCommands.
+var DefaultForbiddenCommands = []string{
+	"KEYS", "FLUSHALL", "CONFIG SET", "SELECT", "SWAPDB", "DEBUG",
+}
+
+// WithForbiddenCommands fails the test when the returned client issues one
+// of cmds. Command may be given with subcommand, like "CONFIG SET". The
+// command is not sent to the server, error is returned instead. Connections
+// taken with Client.Conn and clients created from the returned client
+// options are not checked.
+func WithForbiddenCommands(cmds ...string) Option {
+	return func(o *testRedisOptions) {
+		o.forbidden = cmds
+	}
+}
+
+// forbidHook fails the test on forbidden commands.
+type forbidHook struct {
+	t testing.TB
+	// forbidden commands as lowercase command and optional subcommand
+	forbidden [][]string
+}
+
+func newForbidHook(t testing.TB, cmds []string) forbidHook {
+	h := forbidHook{t: t}
+	for _, c := range cmds {
+		if f := strings.Fields(strings.ToLower(c)); len(f) != 0 {
+			h.forbidden = append(h.forbidden, f)
+		}
+	}
+	return h
+}
+
+// check returns error if cmd is forbidden. t.Errorf is used, as commands may
+// be issued by goroutines other than the test one.
+func (h forbidHook) check(cmd redis.Cmder) error {
+	if !isForbidden(h.forbidden, cmd.Args()) {
+		return nil
+	}
+	err := fmt.Errorf("redis command %v is forbidden in tests",
+		strings.ToUpper(cmd.Name()))
+	h.t.Errorf("%v: %v", err, cmd)
+	return err
+}
+
+// isForbidden reports if command with args matches one of forbidden.
+func isForbidden(forbidden [][]string, args []interface{}) bool {
+	for _, f := range forbidden {
+		if len(args) < len(f) {
+			continue
+		}
+		match := true
+		for i, part := range f {
+			a, ok := args[i].(string)
+			if !ok || strings.ToLower(a) != part {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func (h forbidHook) BeforeProcess(
+	ctx context.Context, cmd redis.Cmder,
+) (context.Context, error) {
+	return ctx, h.check(cmd)
+}
+
+func (h forbidHook) AfterProcess(
+	ctx context.Context, cmd redis.Cmder,
+) error {
+	return nil
+}
+
+func (h forbidHook) BeforeProcessPipeline(
+	ctx context.Context, cmds []redis.Cmder,
+) (context.Context, error) {
+	for _, cmd := range cmds {
+		if err := h.check(cmd); err != nil {
+			return ctx, err
+		}
+	}
+	return ctx, nil
+}
+
+func (h forbidHook) AfterProcessPipeline(
+	ctx context.Context, cmds []redis.Cmder,
+) error {
+	return nil
+}
@@ -0,0 +1,89 @@
+package go_test_redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/api/trace/tracetest"
+)
+
+type errorsRecorder struct {
+	testing.TB
+	errs []string
+}
+
+func (r *errorsRecorder) Errorf(format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func TestForbidHook(t *testing.T) {
+	rec := &errorsRecorder{TB: t}
+	h := newForbidHook(rec, DefaultForbiddenCommands)
+	ctx := context.Background()
+
+	testCases := []struct {
+		args      []interface{}
+		forbidden bool
+	}{
+		{[]interface{}{"keys", "*"}, true},
+		{[]interface{}{"KEYS", "*"}, true},
+		{[]interface{}{"select", 1}, true},
+		{[]interface{}{"config", "set", "maxmemory", "1"}, true},
+		{[]interface{}{"config", "get", "maxmemory"}, false},
+		{[]interface{}{"config"}, false},
+		{[]interface{}{"flushdb"}, false},
+		{[]interface{}{"get", "keys"}, false},
+	}
+	for _, tc := range testCases {
+		rec.errs = nil
+		cmd := redis.NewCmd(ctx, tc.args...)
+		_, err := h.BeforeProcess(ctx, cmd)
+		if (err != nil) != tc.forbidden ||
+			(len(rec.errs) != 0) != tc.forbidden {
+
+			t.Errorf("%v: err = %v, test errors = %v", tc.args, err,
+				rec.errs)
+		}
+	}
+
+	rec.errs = nil
+	cmds := []redis.Cmder{
+		redis.NewCmd(ctx, "get", "a"),
+		redis.NewCmd(ctx, "flushall"),
+	}
+	if _, err := h.BeforeProcessPipeline(ctx, cmds); err == nil ||
+		len(rec.errs) != 1 {
+
+		t.Fatal(err, rec.errs)
+	}
+}
+
+func TestInternalQueriesNotHooked(t *testing.T) {
+	newTestServer(t)
+	var recorder tracetest.StandardSpanRecorder
+	tp := tracetest.NewTracerProvider(tracetest.WithSpanRecorder(&recorder))
+	rec := &errorsRecorder{TB: t}
+
+	t.Run("lease", func(t *testing.T) {
+		rec.TB = t
+		cli := WithRedis(rec, WithDebug(), WithTracerProvider(tp),
+			WithForbiddenCommands("DBSIZE", "CLIENT", "SCAN", "TYPE"))
+		err := cli.Set(context.Background(), "a", "b", 0).Err()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// cleanup of the lease runs its own queries, they are not checked
+	if len(rec.errs) != 0 {
+		t.Fatal(rec.errs)
+	}
+	for _, s := range recorder.Completed() {
+		if strings.HasPrefix(s.Name(), "redis ") && s.Name() != "redis set" {
+			t.Errorf("query of the package is traced: %v", s.Name())
+		}
+	}
+}
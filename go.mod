@@ -1,5 +1,15 @@
 module github.com/olomix/go-test-redis
 
-go 1.15
+go 1.17
 
-require github.com/go-redis/redis/v8 v8.3.2
+require (
+	github.com/alicebob/miniredis/v2 v2.37.0
+	github.com/go-redis/redis/v8 v8.3.2
+	go.opentelemetry.io/otel v0.13.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.1.1 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+)
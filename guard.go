@@ -0,0 +1,133 @@
+package go_test_redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// allowedHostsEnv is the name of environment variable with comma separated
+// list of hosts (or host:port pairs) of test redis servers.
+const allowedHostsEnv = "REDISTEST_ALLOWED_HOSTS"
+
+// allowAnyServerEnv is the name of environment variable that disables
+// checking if redis server is a test one.
+const allowAnyServerEnv = "REDISTEST_ALLOW_ANY_SERVER"
+
+// testServerKey marks redis server as a test one. It is kept in the control
+// database.
+const testServerKey = "redis-test-server"
+
+// checkedServers caches addresses of servers known to be test ones.
+var checkedServers sync.Map
+
+// checkTestServer returns error if redis server cli is connected to is not
+// known to be a test server, so its data must not be flushed. Server is a
+// test one if its host (localhost for all loopback addresses) or unix socket
+// path is listed in REDISTEST_ALLOWED_HOSTS environment variable or its
+// control database contains redis-test-server key. The check is disabled
+// with REDISTEST_ALLOW_ANY_SERVER=true.
+func checkTestServer(ctx context.Context, cli *redis.Client) error {
+	if v := os.Getenv(allowAnyServerEnv); v != "" {
+		allow, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %v: %w", allowAnyServerEnv, err)
+		}
+		if allow {
+			return nil
+		}
+	}
+
+	opts := cli.Options()
+	cacheKey := fmt.Sprintf("%v/%v", opts.Addr, opts.DB)
+	if _, ok := checkedServers.Load(cacheKey); ok {
+		return nil
+	}
+
+	allowed := hostAllowed(opts.Addr, splitHosts(os.Getenv(allowedHostsEnv)))
+	if !allowed {
+		n, err := cli.Exists(ctx, testServerKey).Result()
+		if err != nil {
+			return err
+		}
+		allowed = n != 0
+	}
+	if !allowed {
+		return fmt.Errorf("refusing to use redis at %v: it is not known "+
+			"to be a test server and its data could be flushed; mark it "+
+			"with `go-test-redis mark` (sets %v key in database %v), add "+
+			"its host to %v environment variable or set %v=true",
+			opts.Addr, testServerKey, opts.DB, allowedHostsEnv,
+			allowAnyServerEnv)
+	}
+	checkedServers.Store(cacheKey, struct{}{})
+	return nil
+}
+
+// hostAllowed reports if redis address addr matches one of allowed hosts or
+// host:port pairs. Local servers are not trusted by default, an SSH tunnel
+// or port forwarding may lead to production one; localhost entry allows all
+// loopback addresses.
+func hostAllowed(addr string, allowed []string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(a, addr) || strings.EqualFold(a, host) {
+			return true
+		}
+		if strings.EqualFold(a, "localhost") && isLoopback(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoopback reports if host of redis address is a loopback one. Empty host
+// means localhost.
+func isLoopback(host string) bool {
+	if host == "" || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func splitHosts(s string) []string {
+	var hosts []string
+	for _, h := range strings.Split(s, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// MarkTestServer marks redis server as a test one, so tests may use and
+// flush its databases. Redis address is taken from REDISADDR environment
+// variable, the marker is set in the control database.
+func MarkTestServer(ctx context.Context) (err error) {
+	dbs, err := dbConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	cli := redis.NewClient(withClientName(newRedisOpts(dbs.control),
+		clientNamePrefix+":"+clientKindControl))
+	defer func() {
+		err2 := cli.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	return cli.Set(ctx, testServerKey, time.Now().UTC().Format(time.RFC3339),
+		0).Err()
+}
@@ -0,0 +1,86 @@
+package go_test_redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestHostAllowed(t *testing.T) {
+	allowed := []string{"redis", "ci-redis:6380", "/tmp/redis.sock"}
+	testCases := []struct {
+		addr string
+		ok   bool
+	}{
+		// local servers are not trusted without explicit entry
+		{"", false},
+		{":6379", false},
+		{"localhost:6379", false},
+		{"127.0.0.1:6379", false},
+		{"[::1]:6379", false},
+		{"/tmp/other.sock", false},
+		{"/tmp/redis.sock", true},
+		{"redis:6379", true},
+		{"REDIS:6379", true},
+		{"ci-redis:6380", true},
+		{"ci-redis:6379", false},
+		{"prod-redis:6379", false},
+		{"10.0.0.1:6379", false},
+	}
+	for _, tc := range testCases {
+		if ok := hostAllowed(tc.addr, allowed); ok != tc.ok {
+			t.Errorf("hostAllowed(%q) = %v, want %v", tc.addr, ok, tc.ok)
+		}
+	}
+
+	local := []string{"localhost"}
+	testCases = []struct {
+		addr string
+		ok   bool
+	}{
+		{"", true},
+		{":6379", true},
+		{"localhost:6379", true},
+		{"127.1.2.3:6379", true},
+		{"[::1]:6379", true},
+		{"/tmp/redis.sock", false},
+		{"10.0.0.1:6379", false},
+	}
+	for _, tc := range testCases {
+		if ok := hostAllowed(tc.addr, local); ok != tc.ok {
+			t.Errorf("hostAllowed(%q) with localhost = %v, want %v",
+				tc.addr, ok, tc.ok)
+		}
+	}
+}
+
+func TestCheckTestServer(t *testing.T) {
+	s := newTestServer(t)
+	s.Del(testServerKey)
+	setEnv(t, allowedHostsEnv, "")
+	setEnv(t, allowAnyServerEnv, "")
+	ctx := context.Background()
+	// results are cached per control database, so every check uses other
+	check := func(db int) error {
+		cli := redis.NewClient(newRedisOpts(db))
+		defer closeOrFatal(t, cli)
+		return checkTestServer(ctx, cli)
+	}
+
+	// loopback address may be a tunnel to production server
+	if err := check(0); err == nil {
+		t.Fatal("unmarked local server is allowed")
+	}
+	setEnv(t, allowedHostsEnv, "localhost")
+	if err := check(1); err != nil {
+		t.Fatal(err)
+	}
+	setEnv(t, allowedHostsEnv, "")
+	if err := s.DB(2).Set(testServerKey, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := check(2); err != nil {
+		t.Fatal(err)
+	}
+}
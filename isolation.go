@@ -0,0 +1,195 @@
+package go_test_redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// WithIsolationWatch watches keyspace notifications of other test databases
+// while the test is running. When a key of other database is changed and
+// some connection of the lease is selected to that database at the moment,
+// the test fails. It catches code under test that writes into databases of
+// other tests with SELECT or MOVE and switches back before cleanup, but
+// requires notify-keyspace-events server setting to include "EA" classes.
+//
+// Connections of the lease are always checked to be selected to the leased
+// database at cleanup.
+func WithIsolationWatch() Option {
+	return func(o *testRedisOptions) {
+		o.isolationWatch = true
+	}
+}
+
+// keyeventPattern matches channels of keyevent notifications of all
+// databases.
+const keyeventPattern = "__keyevent@*__:*"
+
+// checkIsolation fails the test if some connection of the lease is selected
+// to database other than db. It must be called before clients of the test
+// are closed.
+func checkIsolation(
+	ctx context.Context, t testing.TB, cli *redis.Client, db int,
+	leaseName string,
+) {
+	clients, err := listClients(ctx, cli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	breaches := isolationBreaches(clients, leaseName, db)
+	if len(breaches) == 0 {
+		return
+	}
+	descriptions := make([]string, len(breaches))
+	for i, c := range breaches {
+		descriptions[i] = fmt.Sprintf("db=%v %v", c.DB, describeClient(c))
+	}
+	t.Errorf("%v connections of the test left redis database %v, "+
+		"other tests may be broken:\n%v",
+		len(breaches), db, strings.Join(descriptions, "\n"))
+}
+
+// isolationBreaches returns connections named leaseName selected to
+// database other than db.
+func isolationBreaches(
+	clients []ClientInfo, leaseName string, db int,
+) []ClientInfo {
+	var breaches []ClientInfo
+	for _, c := range clients {
+		if c.Name == leaseName && c.DB != db {
+			breaches = append(breaches, c)
+		}
+	}
+	return breaches
+}
+
+// isolationWatch records writes into other test databases made while
+// connections of the lease were selected to them.
+type isolationWatch struct {
+	cli      *redis.Client
+	pubsub   *redis.PubSub
+	done     chan struct{}
+	breaches []string
+}
+
+// watchIsolation starts watching keyspace notifications of databases dbs
+// other than db. opts are options of connections to the control database.
+func watchIsolation(
+	ctx context.Context, t testing.TB, opts *redis.Options, db int,
+	dbs []int, leaseName string,
+) *isolationWatch {
+	w := &isolationWatch{
+		cli:  redis.NewClient(opts),
+		done: make(chan struct{}),
+	}
+	// CONFIG may be disabled on the server, the setting is not checked then
+	cfg, err := w.cli.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err == nil && len(cfg) == 2 && !keyeventsEnabled(fmt.Sprint(cfg[1])) {
+		t.Logf("keyspace notifications are disabled on redis server, " +
+			"set notify-keyspace-events to EA to watch isolation of tests")
+	}
+
+	w.pubsub = w.cli.PSubscribe(ctx, keyeventPattern)
+	// wait for subscription confirmation, so we do not miss events
+	if _, err := w.pubsub.Receive(ctx); err != nil {
+		_ = w.pubsub.Close()
+		_ = w.cli.Close()
+		t.Fatal(err)
+	}
+
+	msgs := w.pubsub.Channel()
+	go func() {
+		defer close(w.done)
+		for msg := range msgs {
+			events := []*redis.Message{msg}
+			// list clients once for events already queued
+		drain:
+			for {
+				select {
+				case msg, ok := <-msgs:
+					if !ok {
+						break drain
+					}
+					events = append(events, msg)
+				default:
+					break drain
+				}
+			}
+			w.check(ctx, events, db, dbs, leaseName)
+		}
+	}()
+	return w
+}
+
+func (w *isolationWatch) check(
+	ctx context.Context, events []*redis.Message, db int, dbs []int,
+	leaseName string,
+) {
+	var foreign []*redis.Message
+	for _, e := range events {
+		n, _, ok := parseKeyeventChannel(e.Channel)
+		if ok && n != db && containsDB(dbs, n) {
+			foreign = append(foreign, e)
+		}
+	}
+	if len(foreign) == 0 {
+		return
+	}
+
+	clients, err := listClients(ctx, w.cli)
+	if err != nil {
+		w.breaches = append(w.breaches,
+			fmt.Sprintf("can't list clients: %v", err))
+		return
+	}
+	for _, e := range foreign {
+		n, event, _ := parseKeyeventChannel(e.Channel)
+		for _, c := range clients {
+			if c.Name == leaseName && c.DB == n {
+				w.breaches = append(w.breaches, fmt.Sprintf(
+					"%v %v in database %v by %v", event, e.Payload, n,
+					describeClient(c)))
+				break
+			}
+		}
+	}
+}
+
+// stop stops watching and returns descriptions of detected writes.
+func (w *isolationWatch) stop() ([]string, error) {
+	err := w.pubsub.Close()
+	<-w.done
+	if err2 := w.cli.Close(); err == nil {
+		err = err2
+	}
+	return w.breaches, err
+}
+
+// parseKeyeventChannel returns database and event name from keyevent
+// notification channel, like __keyevent@3__:set.
+func parseKeyeventChannel(ch string) (int, string, bool) {
+	const prefix = "__keyevent@"
+	if !strings.HasPrefix(ch, prefix) {
+		return 0, "", false
+	}
+	ch = ch[len(prefix):]
+	idx := strings.Index(ch, "__:")
+	if idx < 0 {
+		return 0, "", false
+	}
+	n, err := strconv.Atoi(ch[:idx])
+	if err != nil {
+		return 0, "", false
+	}
+	return n, ch[idx+len("__:"):], true
+}
+
+// keyeventsEnabled reports if notify-keyspace-events setting enables
+// keyevent notifications of some class of commands.
+func keyeventsEnabled(cfg string) bool {
+	return strings.Contains(cfg, "E") && strings.ContainsAny(cfg, "Ag$lshzxet")
+}
@@ -0,0 +1,49 @@
+package go_test_redis
+
+import (
+	"testing"
+)
+
+func TestIsolationBreaches(t *testing.T) {
+	clients := []ClientInfo{
+		{ID: 1, Name: "go-test-redis:lease:a:pkg:TestA", DB: 3},
+		{ID: 2, Name: "go-test-redis:lease:a:pkg:TestA", DB: 5},
+		{ID: 3, Name: "go-test-redis:lease:b:pkg:TestB", DB: 5},
+		{ID: 4, Name: "go-test-redis:control:a:pkg:TestA", DB: 0},
+	}
+	breaches := isolationBreaches(clients, "go-test-redis:lease:a:pkg:TestA",
+		3)
+	if len(breaches) != 1 || breaches[0].ID != 2 {
+		t.Fatal(breaches)
+	}
+}
+
+func TestParseKeyeventChannel(t *testing.T) {
+	testCases := []struct {
+		ch    string
+		db    int
+		event string
+		ok    bool
+	}{
+		{"__keyevent@3__:set", 3, "set", true},
+		{"__keyevent@12__:expired", 12, "expired", true},
+		{"__keyspace@3__:key", 0, "", false},
+		{"__keyevent@x__:set", 0, "", false},
+		{"__keyevent@3", 0, "", false},
+	}
+	for _, tc := range testCases {
+		db, event, ok := parseKeyeventChannel(tc.ch)
+		if db != tc.db || event != tc.event || ok != tc.ok {
+			t.Errorf("parseKeyeventChannel(%q) = %v, %q, %v", tc.ch, db,
+				event, ok)
+		}
+	}
+
+	for cfg, want := range map[string]bool{
+		"": false, "AE": true, "KA": false, "E$": true, "KE": false,
+	} {
+		if got := keyeventsEnabled(cfg); got != want {
+			t.Errorf("keyeventsEnabled(%q) = %v", cfg, got)
+		}
+	}
+}
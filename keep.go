@@ -0,0 +1,101 @@
+package go_test_redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// keepOnFailureEnv is the name of environment variable with default grace
+// period for WithKeepOnFailure option.
+const keepOnFailureEnv = "REDISTEST_KEEP_ON_FAILURE"
+
+// WithKeepOnFailure leaves database of failed test intact and locked for
+// grace period, so it can be inspected with redis-cli. After grace period
+// the lock expires and the database is flushed by the next test that picks
+// it. The default grace period may be set with REDISTEST_KEEP_ON_FAILURE
+// environment variable, like REDISTEST_KEEP_ON_FAILURE=30m. Zero grace
+// period disables keeping.
+func WithKeepOnFailure(grace time.Duration) Option {
+	return func(o *testRedisOptions) {
+		o.keepOnFailure = grace
+	}
+}
+
+// keepOnFailureFromEnv returns grace period from environment variable.
+func keepOnFailureFromEnv(t testing.TB) time.Duration {
+	v := os.Getenv(keepOnFailureEnv)
+	if v == "" {
+		return 0
+	}
+	grace, err := time.ParseDuration(v)
+	if err != nil {
+		t.Fatalf("invalid %v: %v", keepOnFailureEnv, err)
+	}
+	return grace
+}
+
+// keepDB extends the lock of db to grace period and marks the database as
+// kept, so it would be reclaimed after lock expiration. ctl must be
+// connected to the control database.
+func keepDB(
+	ctx context.Context, t testing.TB, ctl *redis.Client, locker Locker,
+	ns namespace, addr string, db int, grace time.Duration,
+) {
+	if err := locker.Refresh(ctx, db, grace); err != nil {
+		t.Fatal(err)
+	}
+	err := ctl.Set(ctx, ns.keptKey(db), time.Now().Format(time.RFC3339), 0).
+		Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := fmt.Sprintf("redis-cli -n %v", db)
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if host == "" {
+			host = "localhost"
+		}
+		cmd = fmt.Sprintf("redis-cli -h %v -p %v -n %v", host, port, db)
+	}
+	t.Logf("test failed, redis database %v is kept for %v: %v",
+		db, grace, cmd)
+}
+
+// reclaimKeptDB flushes dirty database that was kept after test failure and
+// which lock expired. Connection must be selected to the control database
+// and hold the lock of db. Returns false if db was not kept. Connection is
+// left selected to the control database.
+func reclaimKeptDB(
+	ctx context.Context, t testing.TB, conn *redis.Conn, dbs dbConfig, db int,
+) bool {
+	n, err := conn.Exists(ctx, dbs.namespace.keptKey(db)).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		return false
+	}
+
+	if err = conn.Select(ctx, db).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.FlushDB(ctx).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Select(ctx, dbs.control).Err(); err != nil {
+		t.Fatal(err)
+	}
+	ns := dbs.namespace
+	err = conn.Del(ctx, ns.keptKey(db), ns.leasedKey(db), ns.dirtyKey(db)).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("reclaimed redis database %v kept after test failure", db)
+	return true
+}
@@ -0,0 +1,63 @@
+package go_test_redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestKeepOnFailureFromEnv(t *testing.T) {
+	setEnv(t, keepOnFailureEnv, "")
+	if grace := keepOnFailureFromEnv(t); grace != 0 {
+		t.Fatal(grace)
+	}
+	setEnv(t, keepOnFailureEnv, "30m")
+	if grace := keepOnFailureFromEnv(t); grace != 30*time.Minute {
+		t.Fatal(grace)
+	}
+}
+
+func TestKeepAndReclaimDB(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	dbs := dbConfig{control: 0}
+	ctl := redis.NewClient(newRedisOpts(dbs.control))
+	defer closeOrFatal(t, ctl)
+	locker := NewRedisLocker(ctl, "")
+
+	ok, err := locker.TryLock(ctx, 3, "v", time.Minute)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	s.DB(3).Set("a", "1")
+
+	keepDB(ctx, t, ctl, locker, dbs.namespace, s.Addr(), 3, time.Hour)
+	if ttl := s.TTL(dbs.namespace.lockKey(3)); ttl != time.Hour {
+		t.Fatalf("lock must be extended to grace period, got %v", ttl)
+	}
+	if !s.Exists(dbs.namespace.keptKey(3)) {
+		t.Fatal("kept marker is not set")
+	}
+
+	conn := ctl.Conn(ctx)
+	defer closeOrFatal(t, conn)
+	if reclaimKeptDB(ctx, t, conn, dbs, 4) {
+		t.Fatal("database 4 was not kept")
+	}
+	if !reclaimKeptDB(ctx, t, conn, dbs, 3) {
+		t.Fatal("kept database 3 is not reclaimed")
+	}
+	if keys := s.DB(3).Keys(); len(keys) != 0 {
+		t.Fatalf("database is not flushed: %v", keys)
+	}
+	if s.Exists(dbs.namespace.keptKey(3)) {
+		t.Fatal("kept marker is not deleted")
+	}
+	// connection is left selected to the control database
+	n, err := conn.Exists(ctx, dbs.namespace.lockKey(3)).Result()
+	if err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+}
@@ -0,0 +1,106 @@
+package go_test_redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type leakCheckMode int
+
+const (
+	leakCheckOff leakCheckMode = iota
+	leakCheckWarn
+	leakCheckFail
+)
+
+// WithLeakCheck reports connections left open by the test on cleanup:
+// connections of the returned client that were not returned to its pool
+// (not closed Conn or PubSub) and any other connections to the leased
+// database, like clients created from the returned client options and
+// not closed. If failTest is true, the test fails, otherwise leaks are
+// only logged.
+func WithLeakCheck(failTest bool) Option {
+	return func(o *testRedisOptions) {
+		if failTest {
+			o.leakCheck = leakCheckFail
+		} else {
+			o.leakCheck = leakCheckWarn
+		}
+	}
+}
+
+func reportLeak(t testing.TB, mode leakCheckMode, format string,
+	args ...interface{}) {
+
+	switch mode {
+	case leakCheckWarn:
+		t.Logf(format, args...)
+	case leakCheckFail:
+		t.Errorf(format, args...)
+	}
+}
+
+// checkPoolLeaks reports connections of cli that are in use. It must be
+// called before cli is closed.
+func checkPoolLeaks(t testing.TB, mode leakCheckMode, cli *redis.Client) {
+	stats := cli.PoolStats()
+	if inUse := stats.TotalConns - stats.IdleConns; inUse > 0 {
+		reportLeak(t, mode,
+			"%v connections of redis client were not closed "+
+				"(Conn or PubSub objects)", inUse)
+	}
+}
+
+// checkClientLeaks reports clients still connected to database db or named
+// as connections of the lease. All clients of the test must be closed before
+// the call. ctl must not be connected to db.
+func checkClientLeaks(
+	ctx context.Context, t testing.TB, mode leakCheckMode, ctl *redis.Client,
+	db int, leaseName string,
+) {
+	var leaked []ClientInfo
+	// server may process closing of connections with some delay
+	for i := 0; i < 5; i++ {
+		if i != 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		clients, err := listClients(ctx, ctl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaked = leaked[:0]
+		for _, c := range clients {
+			if c.DB == db || c.Name == leaseName {
+				leaked = append(leaked, c)
+			}
+		}
+		if len(leaked) == 0 {
+			return
+		}
+	}
+
+	descriptions := make([]string, len(leaked))
+	for i, c := range leaked {
+		descriptions[i] = describeClient(c)
+	}
+	reportLeak(t, mode,
+		"%v connections to redis database %v were not closed:\n%v",
+		len(leaked), db, strings.Join(descriptions, "\n"))
+}
+
+func describeClient(c ClientInfo) string {
+	s := fmt.Sprintf("id=%v addr=%v age=%v idle=%v cmd=%v",
+		c.ID, c.Addr, c.Age, c.Idle, c.Cmd)
+	if c.Name != "" {
+		s += " name=" + c.Name
+	}
+	if c.Subscriptions != 0 {
+		s += fmt.Sprintf(" subscriptions=%v", c.Subscriptions)
+	}
+	return s
+}
@@ -0,0 +1,80 @@
+package go_test_redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestCheckClientLeaks(t *testing.T) {
+	newTestServer(t)
+	ctx := context.Background()
+	leaseName := leaseClientName(clientKindLease, "abc", t.Name())
+	ctl := redis.NewClient(newRedisOpts(0))
+	defer closeOrFatal(t, ctl)
+
+	// lease connection selected to other database, unnamed connection to
+	// the leased database and connection of other test
+	clients := []*redis.Client{
+		redis.NewClient(withClientName(newRedisOpts(0), leaseName)),
+		redis.NewClient(newRedisOpts(3)),
+		redis.NewClient(withClientName(newRedisOpts(4),
+			leaseClientName(clientKindLease, "def", t.Name()))),
+	}
+	defer closeOrFatal(t, clients[2])
+	for _, cli := range clients {
+		if err := cli.Ping(ctx).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := &errorsRecorder{TB: t}
+	checkClientLeaks(ctx, rec, leakCheckFail, ctl, 3, leaseName)
+	if len(rec.errs) != 1 {
+		t.Fatal(rec.errs)
+	}
+	msg := rec.errs[0]
+	// connections of other tests are not reported
+	if !strings.HasPrefix(msg, "2 connections to redis database 3") ||
+		!strings.Contains(msg, "name="+leaseName) ||
+		strings.Contains(msg, ":def:") {
+
+		t.Fatal(msg)
+	}
+
+	// connections of the lease are closed
+	for _, cli := range clients[:2] {
+		closeOrFatal(t, cli)
+	}
+	rec.errs = nil
+	checkClientLeaks(ctx, rec, leakCheckFail, ctl, 3, leaseName)
+	if len(rec.errs) != 0 {
+		t.Fatal(rec.errs)
+	}
+}
+
+func TestCheckPoolLeaks(t *testing.T) {
+	newTestServer(t)
+	ctx := context.Background()
+	cli := redis.NewClient(newRedisOpts(3))
+	defer closeOrFatal(t, cli)
+
+	conn := cli.Conn(ctx)
+	if err := conn.Ping(ctx).Err(); err != nil {
+		t.Fatal(err)
+	}
+	rec := &errorsRecorder{TB: t}
+	checkPoolLeaks(rec, leakCheckFail, cli)
+	if len(rec.errs) != 1 || !strings.HasPrefix(rec.errs[0], "1 connections") {
+		t.Fatal(rec.errs)
+	}
+
+	closeOrFatal(t, conn)
+	rec.errs = nil
+	checkPoolLeaks(rec, leakCheckFail, cli)
+	if len(rec.errs) != 0 {
+		t.Fatal(rec.errs)
+	}
+}
@@ -0,0 +1,263 @@
+package go_test_redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Lease describes lock of test database held by some test.
+type Lease struct {
+	DB int `json:"db"`
+	// ID of the lease, it is a part of names of connections made by the
+	// test holding the lock.
+	ID string `json:"id,omitempty"`
+	// Test is the name of the test holding the lock.
+	Test string `json:"test,omitempty"`
+	Host string `json:"host,omitempty"`
+	PID  int    `json:"pid,omitempty"`
+	// Since is the time lock was acquired.
+	Since time.Time `json:"since"`
+	// TTL is time remaining before lock expires.
+	TTL time.Duration `json:"ttl"`
+	// Clients are connections currently using the database or made by the
+	// test holding the lock.
+	Clients []ClientInfo `json:"clients"`
+}
+
+// leaseValue is stored as a value of lock key.
+type leaseValue struct {
+	ID    string    `json:"id"`
+	Test  string    `json:"test"`
+	Host  string    `json:"host"`
+	PID   int       `json:"pid"`
+	Since time.Time `json:"since"`
+}
+
+func newLeaseValue(t testing.TB, leaseID string) string {
+	v, err := encodeLeaseValue(leaseID, t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func encodeLeaseValue(leaseID, test string) (string, error) {
+	host, _ := os.Hostname()
+	v, err := json.Marshal(leaseValue{
+		ID:    leaseID,
+		Test:  test,
+		Host:  host,
+		PID:   os.Getpid(),
+		Since: time.Now().UTC().Truncate(time.Second),
+	})
+	return string(v), err
+}
+
+// refreshLease prolongs the lock of db to lockTimeout every interval while
+// the test runs, so the database of a long test is not taken by others.
+// Failed refresh is retried on the next tick. stop ends refreshing and
+// reports the first refresh error, if any.
+func refreshLease(
+	locker Locker, db int, interval time.Duration,
+) (stop func() error) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	var err error
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			e := locker.Refresh(context.Background(), db, lockTimeout)
+			if e != nil && err == nil {
+				err = e
+			}
+		}
+	}()
+	return func() error {
+		close(done)
+		<-exited
+		if err != nil {
+			return fmt.Errorf("can't refresh lock of database %v: %w", db, err)
+		}
+		return nil
+	}
+}
+
+// parseLeaseValue decodes value of lock key. Old versions stored only lock
+// time in RFC3339 format, it is supported too.
+func parseLeaseValue(db int, v string) (Lease, error) {
+	l := Lease{DB: db}
+	if strings.HasPrefix(v, "{") {
+		var lv leaseValue
+		if err := json.Unmarshal([]byte(v), &lv); err != nil {
+			return l, err
+		}
+		l.ID, l.Test, l.Host, l.PID = lv.ID, lv.Test, lv.Host, lv.PID
+		l.Since = lv.Since
+		return l, nil
+	}
+
+	var err error
+	l.Since, err = time.Parse(time.RFC3339, v)
+	return l, err
+}
+
+// ListLeases returns all currently held locks of test databases ordered by
+// database number with clients connected to each database. Redis address is
+// taken from REDISADDR environment variable.
+func ListLeases(ctx context.Context) (leases []Lease, err error) {
+	dbs, err := dbConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	cli := redis.NewClient(withClientName(newRedisOpts(dbs.control),
+		clientNamePrefix+":"+clientKindControl))
+	defer func() {
+		err2 := cli.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	locks, err := NewRedisLocker(cli, string(dbs.namespace)).Locks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].DB < locks[j].DB })
+
+	clients, err := listClients(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	clientsByDB := make(map[int][]ClientInfo)
+	clientsByLease := make(map[string][]ClientInfo)
+	for _, c := range clients {
+		if id := leaseIDFromClientName(c.Name); id != "" {
+			clientsByLease[id] = append(clientsByLease[id], c)
+		} else {
+			clientsByDB[c.DB] = append(clientsByDB[c.DB], c)
+		}
+	}
+
+	leases = make([]Lease, 0, len(locks))
+	for _, lock := range locks {
+		l, err := parseLeaseValue(lock.DB, lock.Value)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse lock of database %v: %w",
+				lock.DB, err)
+		}
+		l.TTL = lock.TTL
+		l.Clients = append(clientsByDB[lock.DB], clientsByLease[l.ID]...)
+		leases = append(leases, l)
+	}
+	return leases, nil
+}
+
+// ResetDatabases forcefully flushes all test databases and releases their
+// locks. Databases with data not created by tests are never flushed, error
+// is returned for them. Databases configuration is taken from
+// REDISTEST_CONTROL_DB, REDISTEST_DATABASES and REDISTEST_NAMESPACE
+// environment variables. It must not be used while tests are running.
+func ResetDatabases(ctx context.Context) (err error) {
+	dbs, err := dbConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	cli := redis.NewClient(withClientName(newRedisOpts(dbs.control),
+		clientNamePrefix+":"+clientKindControl))
+	defer func() {
+		err2 := cli.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	if err = checkTestServer(ctx, cli); err != nil {
+		return err
+	}
+	n, err := getDatabasesNum(ctx, cli)
+	if err != nil {
+		return err
+	}
+	testDBs, err := dbs.testDatabases(n)
+	if err != nil {
+		return err
+	}
+
+	conn := cli.Conn(ctx)
+	defer func() {
+		err2 := conn.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	ns := dbs.namespace
+	var foreign []int
+	for _, i := range testDBs {
+		owned, err := isOwnedOrEmpty(ctx, conn, dbs, i)
+		if err != nil {
+			return err
+		}
+		if !owned {
+			foreign = append(foreign, i)
+			continue
+		}
+
+		if err = flushDB(ctx, conn, dbs.control, i); err != nil {
+			return err
+		}
+		err = conn.Del(ctx, ns.keptKey(i), ns.dirtyKey(i), ns.leasedKey(i)).
+			Err()
+		if err != nil {
+			return err
+		}
+		err = unlockDB(ctx, newConnLocker(conn, dbs.namespace), i)
+		if err != nil {
+			return err
+		}
+	}
+	if len(foreign) != 0 {
+		return fmt.Errorf("databases %v contain data not created by tests "+
+			"and were not flushed, flush them by hand if it is safe",
+			foreign)
+	}
+	return nil
+}
+
+// isOwnedOrEmpty reports if database db is owned by tests or is empty, so
+// it may be flushed. Connection must be selected to the control database
+// and is left selected to it.
+func isOwnedOrEmpty(
+	ctx context.Context, conn *redis.Conn, dbs dbConfig, db int,
+) (bool, error) {
+	owned, err := conn.SIsMember(ctx, dbs.namespace.ownedKey(), db).Result()
+	if err != nil || owned {
+		return owned, err
+	}
+	if err = conn.Select(ctx, db).Err(); err != nil {
+		return false, err
+	}
+	size, err := conn.DBSize(ctx).Result()
+	if err != nil {
+		return false, err
+	}
+	if err = conn.Select(ctx, dbs.control).Err(); err != nil {
+		return false, err
+	}
+	return size == 0, nil
+}
@@ -0,0 +1,202 @@
+package go_test_redis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestParseLeaseValue(t *testing.T) {
+	l, err := parseLeaseValue(3, `{"test":"TestCache/sub","host":"ci-1",`+
+		`"pid":42,"since":"2020-10-20T10:11:12Z"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Lease{
+		DB:    3,
+		Test:  "TestCache/sub",
+		Host:  "ci-1",
+		PID:   42,
+		Since: time.Date(2020, 10, 20, 10, 11, 12, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(l, want) {
+		t.Fatal(l)
+	}
+
+	// value written by old versions
+	l, err = parseLeaseValue(5, "2020-10-20T10:11:12Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = Lease{
+		DB:    5,
+		Since: time.Date(2020, 10, 20, 10, 11, 12, 0, time.UTC),
+	}
+	if !l.Since.Equal(want.Since) || l.DB != want.DB || l.Test != "" {
+		t.Fatal(l)
+	}
+
+	if _, err = parseLeaseValue(1, "garbage"); err == nil {
+		t.Fatal("expected error on invalid lock value")
+	}
+}
+
+func TestParseLockKey(t *testing.T) {
+	testCases := []struct {
+		key  string
+		db   int
+		isOK bool
+	}{
+		{"redis-test-1", 1, true},
+		{"redis-test-15", 15, true},
+		{"redis-test-", 0, false},
+		{"redis-test-01", 0, false},
+		{"redis-test-1x", 0, false},
+		{"redis-test-broadcast", 0, false},
+		{"other-1", 0, false},
+	}
+	for _, tc := range testCases {
+		db, ok := namespace("").parseLockKey(tc.key)
+		if db != tc.db || ok != tc.isOK {
+			t.Errorf("parseLockKey(%q) = %v, %v", tc.key, db, ok)
+		}
+	}
+}
+
+func TestIsOwnedOrEmpty(t *testing.T) {
+	newTestServer(t)
+	ctx := context.Background()
+	ctl := redis.NewClient(newRedisOpts(0))
+	defer closeOrFatal(t, ctl)
+	dbs := dbConfig{}
+
+	for _, db := range []int{1, 2} {
+		dbCli := redis.NewClient(newRedisOpts(db))
+		err := dbCli.Set(ctx, "k", "v", 0).Err()
+		closeOrFatal(t, dbCli)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ctl.SAdd(ctx, dbs.namespace.ownedKey(), 1).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := ctl.Conn(ctx)
+	defer closeOrFatal(t, conn)
+	for db, want := range map[int]bool{1: true, 2: false, 3: true} {
+		ok, err := isOwnedOrEmpty(ctx, conn, dbs, db)
+		if err != nil || ok != want {
+			t.Errorf("database %v: %v, %v", db, ok, err)
+		}
+	}
+	// the owned set is visible in the control database only
+	n, err := conn.Exists(ctx, dbs.namespace.ownedKey()).Result()
+	if err != nil || n != 1 {
+		t.Fatalf("connection is not left selected to control database: "+
+			"%v, %v", n, err)
+	}
+}
+
+func TestResetDatabasesRefusesForeign(t *testing.T) {
+	newTestServer(t)
+	setEnv(t, "REDISTEST_DATABASES", "1-3")
+	ctx := context.Background()
+	if err := MarkTestServer(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ctl := redis.NewClient(newRedisOpts(0))
+	defer closeOrFatal(t, ctl)
+	ns := dbConfig{}.namespace
+
+	// database 1 is left by test, database 2 contains real data
+	clients := make([]*redis.Client, 4)
+	for db := 1; db <= 3; db++ {
+		clients[db] = redis.NewClient(newRedisOpts(db))
+		defer closeOrFatal(t, clients[db])
+	}
+	for _, db := range []int{1, 2} {
+		if err := clients[db].Set(ctx, "k", "v", 0).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := ctl.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.SAdd(ctx, ns.ownedKey(), 1)
+		p.Set(ctx, ns.leasedKey(1), "", 0)
+		p.Set(ctx, ns.dirtyKey(1), "", 0)
+		p.Set(ctx, ns.lockKey(1), "", 0)
+		p.Set(ctx, ns.dirtyKey(2), "", 0)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ResetDatabases(ctx)
+	if err == nil || !strings.Contains(err.Error(), "databases [2]") {
+		t.Fatal(err)
+	}
+	for db, want := range map[int]int64{1: 0, 2: 1, 3: 0} {
+		n, err := clients[db].DBSize(ctx).Result()
+		if err != nil || n != want {
+			t.Errorf("database %v: %v keys, %v", db, n, err)
+		}
+	}
+	n, err := ctl.Exists(ctx, ns.leasedKey(1), ns.dirtyKey(1), ns.lockKey(1)).
+		Result()
+	if err != nil || n != 0 {
+		t.Fatal(n, err)
+	}
+	// quarantine of foreign database is kept
+	if n, err = ctl.Exists(ctx, ns.dirtyKey(2)).Result(); err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+}
+
+// flakyLocker fails the first refresh.
+type flakyLocker struct {
+	Locker
+	mu        sync.Mutex
+	refreshes int
+}
+
+func (l *flakyLocker) Refresh(
+	ctx context.Context, db int, ttl time.Duration,
+) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refreshes++
+	if l.refreshes == 1 {
+		return errors.New("connection reset")
+	}
+	return l.Locker.Refresh(ctx, db, ttl)
+}
+
+func TestRefreshLeaseRetries(t *testing.T) {
+	ctx := context.Background()
+	l := &flakyLocker{Locker: NewMemoryLocker()}
+	if _, err := l.TryLock(ctx, 3, "me", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := refreshLease(l, 3, time.Millisecond)
+	waitFor(t, "lock refreshed after failure", func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.refreshes > 2
+	})
+	err := stop()
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatal(err)
+	}
+	locks, err := l.Locks(ctx)
+	if err != nil || len(locks) != 1 || locks[0].TTL <= time.Minute {
+		t.Fatal(locks, err)
+	}
+}
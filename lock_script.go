@@ -0,0 +1,181 @@
+package go_test_redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Results of lockFreeDBScript when it did not lock any database.
+const (
+	// there is no free clean database, some databases are locked
+	scriptAllLocked = -1
+	// no database is locked, all of them are dirty and quarantined
+	scriptAllQuarantined = -2
+)
+
+// lockFreeDBScript finds the first database that is not locked and is empty
+// and locks it. Lock keys are in the control database. Database selected by
+// the script does not affect the calling connection.
+//
+// If there is no such database and reclaiming is enabled, the first free
+// dirty database that may be reclaimed is locked: database not quarantined
+// yet, kept after failed test or owned by tests and allowed to be flushed by
+// the policy. Quarantined databases that can't be reclaimed are skipped
+// without locking them.
+//
+// ARGV: control database, lock key prefix, markers prefix of the namespace,
+// lock value, lock TTL in milliseconds, "1" to reclaim dirty databases, "1"
+// to reclaim leased databases, quarantine time in RFC3339 format before
+// which databases are reclaimed or empty string, databases to check.
+//
+// Returns pair of locked database and 1 if it is dirty, or pair of
+// scriptAllLocked or scriptAllQuarantined and 0.
+var lockFreeDBScript = redis.NewScript(`
+local control = tonumber(ARGV[1])
+local prefix = ARGV[2]
+local markers = ARGV[3]
+local reclaim = ARGV[6] == '1'
+local flushLeased = ARGV[7] == '1'
+local cutoff = ARGV[8]
+
+local function reclaimable(db)
+	local dirty = redis.call('GET', markers .. 'dirty-' .. db)
+	if not dirty then
+		-- database must be quarantined first
+		return true
+	end
+	if redis.call('EXISTS', markers .. 'kept-' .. db) == 1 then
+		return true
+	end
+	if redis.call('SISMEMBER', markers .. 'owned', db) == 0 then
+		return false
+	end
+	if flushLeased and
+		redis.call('EXISTS', markers .. 'leased-' .. db) == 1 then
+		return true
+	end
+	if cutoff ~= '' then
+		local ok, marker = pcall(cjson.decode, dirty)
+		if ok and type(marker) == 'table' and
+			type(marker.since) == 'string' and marker.since <= cutoff then
+			return true
+		end
+	end
+	return false
+end
+
+local locked = false
+local candidate = nil
+for i = 9, #ARGV do
+	local key = prefix .. ARGV[i]
+	redis.call('SELECT', control)
+	if redis.call('EXISTS', key) == 1 then
+		locked = true
+	else
+		redis.call('SELECT', tonumber(ARGV[i]))
+		local size = redis.call('DBSIZE')
+		redis.call('SELECT', control)
+		if size == 0 then
+			redis.call('SET', key, ARGV[4], 'PX', ARGV[5])
+			-- database might be flushed by hand after quarantine
+			redis.call('DEL', markers .. 'dirty-' .. ARGV[i])
+			return {tonumber(ARGV[i]), 0}
+		end
+		if reclaim and candidate == nil and reclaimable(ARGV[i]) then
+			candidate = ARGV[i]
+		end
+	end
+end
+if candidate ~= nil then
+	redis.call('SET', prefix .. candidate, ARGV[4], 'PX', ARGV[5])
+	return {tonumber(candidate), 1}
+end
+if locked then
+	return {-1, 0}
+end
+return {-2, 0}
+`)
+
+// serverLocker is implemented by lockers keeping locks on the same redis
+// server as test databases, so free empty database may be found and locked
+// in one step.
+type serverLocker interface {
+	Locker
+	// lockFreeDB locks the first free empty database of dbs. If there is
+	// no such database and policy is not nil, free dirty database that may
+	// be reclaimed under policy is locked and dirty is true. Returns
+	// scriptAllLocked or scriptAllQuarantined if nothing was locked.
+	lockFreeDB(
+		ctx context.Context, dbs []int, value string, ttl time.Duration,
+		policy *DirtyPolicy,
+	) (db int, dirty bool, err error)
+}
+
+// sameServerLocker is redis locker keeping locks in the control database of
+// the server with test databases.
+type sameServerLocker struct {
+	*redisLocker
+	control int
+}
+
+// newServerLocker returns redis locker over client connected to the control
+// database of the server with test databases.
+func newServerLocker(cli *redis.Client, dbs dbConfig) Locker {
+	return &sameServerLocker{
+		redisLocker: &redisLocker{ns: dbs.namespace, cmd: cli, cli: cli},
+		control:     dbs.control,
+	}
+}
+
+// newServerConnLocker is like newServerLocker but over connection selected
+// to the control database. It can't wait for notifications.
+func newServerConnLocker(conn *redis.Conn, dbs dbConfig) Locker {
+	return &sameServerLocker{
+		redisLocker: &redisLocker{ns: dbs.namespace, cmd: conn},
+		control:     dbs.control,
+	}
+}
+
+func (l *sameServerLocker) lockFreeDB(
+	ctx context.Context, dbs []int, value string, ttl time.Duration,
+	policy *DirtyPolicy,
+) (int, bool, error) {
+	reclaim, flushLeased, cutoff := "0", "0", ""
+	if policy != nil {
+		reclaim = "1"
+		if policy.FlushLeased {
+			flushLeased = "1"
+		}
+		if policy.FlushAfter > 0 {
+			// markers keep UTC time truncated to seconds, so they are
+			// ordered as strings
+			cutoff = time.Now().UTC().Add(-policy.FlushAfter).
+				Format(time.RFC3339)
+		}
+	}
+	args := make([]interface{}, 0, 8+len(dbs))
+	args = append(args, l.control, lockPrefix, l.ns.prefix(), value,
+		strconv.FormatInt(int64(ttl/time.Millisecond), 10), reclaim,
+		flushLeased, cutoff)
+	for _, db := range dbs {
+		args = append(args, db)
+	}
+	r, err := lockFreeDBScript.Run(ctx, l.cmd, nil, args...).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	res, ok := r.([]interface{})
+	if !ok || len(res) != 2 {
+		return 0, false, fmt.Errorf("unexpected reply of lock script: %v", r)
+	}
+	db, ok1 := res[0].(int64)
+	dirty, ok2 := res[1].(int64)
+	if !ok1 || !ok2 {
+		return 0, false, fmt.Errorf("unexpected reply of lock script: %v", r)
+	}
+	return int(db), dirty == 1, nil
+}
@@ -0,0 +1,292 @@
+package go_test_redis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Locker coordinates access to test databases between tests, possibly
+// running in different processes. By default locks are kept in the control
+// database of the same redis server (see NewRedisLocker), other
+// implementations may be set with WithLocker option.
+type Locker interface {
+	// TryLock locks database db with value for ttl. Returns false if the
+	// database is already locked.
+	TryLock(
+		ctx context.Context, db int, value string, ttl time.Duration,
+	) (bool, error)
+	// Refresh sets new ttl of the lock of database db.
+	Refresh(ctx context.Context, db int, ttl time.Duration) error
+	// Unlock releases the lock of database db without notifying waiters.
+	Unlock(ctx context.Context, db int) error
+	// NotifyReleased notifies waiters that database db was released.
+	NotifyReleased(ctx context.Context, db int) error
+	// Released returns channel of numbers of released databases and
+	// function to stop notifications. If locker does not support
+	// notifications, channel is nil and waiters rescan databases
+	// periodically.
+	Released(ctx context.Context) (<-chan int, func() error, error)
+	// Locks returns all currently held locks. Waiters use TTLs of locks to
+	// rescan databases when locks expire.
+	Locks(ctx context.Context) ([]LockInfo, error)
+}
+
+// LockInfo describes lock of database returned by Locker.
+type LockInfo struct {
+	DB    int
+	Value string
+	// TTL is time remaining before lock expires or negative value if lock
+	// never expires.
+	TTL time.Duration
+}
+
+// WithLocker sets the locker used to coordinate access to test databases.
+func WithLocker(l Locker) Option {
+	return func(o *testRedisOptions) {
+		o.locker = l
+	}
+}
+
+// unlockDB releases lock of db and notifies waiters.
+func unlockDB(ctx context.Context, l Locker, db int) error {
+	if err := l.Unlock(ctx, db); err != nil {
+		return err
+	}
+	return l.NotifyReleased(ctx, db)
+}
+
+// releasedStreamLen is approximate number of entries kept in the stream of
+// released databases.
+const releasedStreamLen = 1000
+
+// releasedPollInterval is the longest time reader of released databases
+// blocks on XREAD, so it notices it was stopped.
+const releasedPollInterval = time.Second
+
+type redisLocker struct {
+	ns  namespace
+	cmd redis.Cmdable
+	// cli is used to subscribe to notifications, may be nil
+	cli *redis.Client
+}
+
+// NewRedisLocker returns locker that keeps locks as redis-test-N keys in the
+// database cli is connected to and notifies about released databases by
+// appending them to a stream with XADD and with PUBLISH for older versions
+// of this package. cli must be connected to the control database of the same
+// server that is used by tests, so tests using older versions of this
+// package are coordinated too. Locks and notifications are shared by all
+// namespaces, see WithNamespace; empty namespace is the default one.
+func NewRedisLocker(cli *redis.Client, ns string) Locker {
+	return &redisLocker{ns: namespace(ns), cmd: cli, cli: cli}
+}
+
+// newConnLocker returns redis locker over connection selected to the control
+// database.
+// It can't wait for notifications.
+func newConnLocker(conn *redis.Conn, ns namespace) Locker {
+	return &redisLocker{ns: ns, cmd: conn}
+}
+
+func (l *redisLocker) TryLock(
+	ctx context.Context, db int, value string, ttl time.Duration,
+) (bool, error) {
+	return l.cmd.SetNX(ctx, l.ns.lockKey(db), value, ttl).Result()
+}
+
+func (l *redisLocker) Refresh(
+	ctx context.Context, db int, ttl time.Duration,
+) error {
+	return l.cmd.PExpire(ctx, l.ns.lockKey(db), ttl).Err()
+}
+
+func (l *redisLocker) Unlock(ctx context.Context, db int) error {
+	return l.cmd.Del(ctx, l.ns.lockKey(db)).Err()
+}
+
+// NotifyReleased appends db to the stream of released databases. The
+// number is published to the channel too, for waiters using older versions
+// of this package or redis server without streams.
+func (l *redisLocker) NotifyReleased(ctx context.Context, db int) error {
+	err := l.cmd.XAdd(ctx, &redis.XAddArgs{
+		Stream:       l.ns.releasedStream(),
+		MaxLenApprox: releasedStreamLen,
+		Values:       []interface{}{"db", db},
+	}).Err()
+	if err != nil && !isUnknownCommand(err) {
+		return err
+	}
+	return l.cmd.Publish(ctx, l.ns.channel(), strconv.Itoa(db)).Err()
+}
+
+// Released reads the stream of released databases starting from its last
+// entry at the moment of the call, so databases released after the call are
+// never missed. Pub/sub channel is used if redis server does not support
+// streams.
+func (l *redisLocker) Released(
+	ctx context.Context,
+) (<-chan int, func() error, error) {
+	if l.cli == nil {
+		return nil, func() error { return nil }, nil
+	}
+
+	stream := l.ns.releasedStream()
+	last, err := l.cli.XRevRangeN(ctx, stream, "+", "-", 1).Result()
+	if isUnknownCommand(err) {
+		return l.releasedPubSub(ctx)
+	} else if err != nil {
+		return nil, nil, err
+	}
+	lastID := "0-0"
+	if len(last) != 0 {
+		lastID = last[0].ID
+	}
+
+	// XREAD blocks the connection, so it uses own client which is closed by
+	// stop to interrupt the read
+	reader := redis.NewClient(l.cli.Options())
+	ch := make(chan int)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ctx := context.Background()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			streams, err := reader.XRead(ctx, &redis.XReadArgs{
+				Streams: []string{stream, lastID},
+				Block:   releasedPollInterval,
+			}).Result()
+			if err == redis.Nil {
+				continue
+			} else if err != nil {
+				// waiter rescans databases periodically anyway
+				select {
+				case <-done:
+					return
+				case <-time.After(releasedPollInterval):
+				}
+				continue
+			}
+
+			for _, s := range streams {
+				for _, msg := range s.Messages {
+					lastID = msg.ID
+					v, _ := msg.Values["db"].(string)
+					n, err := strconv.Atoi(v)
+					if err != nil {
+						continue
+					}
+					select {
+					case ch <- n:
+					case <-done:
+						return
+					}
+				}
+			}
+		}
+	}()
+	stop := func() error {
+		close(done)
+		err := reader.Close()
+		<-exited
+		return err
+	}
+	return ch, stop, nil
+}
+
+func (l *redisLocker) releasedPubSub(
+	ctx context.Context,
+) (<-chan int, func() error, error) {
+	pubsub := l.cli.Subscribe(ctx, l.ns.channel())
+	// wait for subscription confirmation, so we do not miss messages
+	// published after return
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, nil, err
+	}
+
+	msgs := pubsub.Channel()
+	ch := make(chan int)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		for msg := range msgs {
+			n, err := strconv.Atoi(msg.Payload)
+			if err != nil {
+				continue
+			}
+			select {
+			case ch <- n:
+			case <-done:
+				return
+			}
+		}
+	}()
+	stop := func() error {
+		close(done)
+		err := pubsub.Close()
+		<-exited
+		return err
+	}
+	return ch, stop, nil
+}
+
+func (l *redisLocker) Locks(ctx context.Context) ([]LockInfo, error) {
+	var dbs []int
+	iter := l.cmd.Scan(ctx, 0, l.ns.lockKeyPattern(), 100).Iterator()
+	for iter.Next(ctx) {
+		if n, ok := l.ns.parseLockKey(iter.Val()); ok {
+			dbs = append(dbs, n)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	getCmds := make([]*redis.StringCmd, len(dbs))
+	ttlCmds := make([]*redis.DurationCmd, len(dbs))
+	_, err := l.cmd.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, n := range dbs {
+			getCmds[i] = p.Get(ctx, l.ns.lockKey(n))
+			ttlCmds[i] = p.PTTL(ctx, l.ns.lockKey(n))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	locks := make([]LockInfo, 0, len(dbs))
+	for i, n := range dbs {
+		v, err := getCmds[i].Result()
+		if err == redis.Nil {
+			// lock was released while we were scanning
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		ttl, err := ttlCmds[i].Result()
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, LockInfo{DB: n, Value: v, TTL: ttl})
+	}
+	return locks, nil
+}
+
+// isUnknownCommand reports if redis server does not support the command,
+// like XADD on servers older than 5.0.
+func isUnknownCommand(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "ERR unknown command")
+}
@@ -0,0 +1,170 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package go_test_redis
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const flockFileTmpl = "db-%d.lock"
+
+type fileLocker struct {
+	dir   string
+	mu    sync.Mutex
+	files map[int]*os.File
+}
+
+// NewFileLocker returns locker that locks files in dir with flock(2). It may
+// be used when all tests using redis server run on the same machine. Locks
+// are released by OS when process exits, so TTLs are ignored. Released
+// databases are not notified, waiters rescan databases periodically.
+func NewFileLocker(dir string) (Locker, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileLocker{dir: dir, files: make(map[int]*os.File)}, nil
+}
+
+func (l *fileLocker) path(db int) string {
+	return filepath.Join(l.dir, fmt.Sprintf(flockFileTmpl, db))
+}
+
+func (l *fileLocker) TryLock(
+	ctx context.Context, db int, value string, ttl time.Duration,
+) (bool, error) {
+	f, err := os.OpenFile(l.path(db), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, f.Close()
+	} else if err != nil {
+		_ = f.Close()
+		return false, err
+	}
+
+	if err = writeLockValue(f, value); err != nil {
+		_ = f.Close()
+		return false, err
+	}
+
+	l.mu.Lock()
+	l.files[db] = f
+	l.mu.Unlock()
+	return true, nil
+}
+
+func writeLockValue(f *os.File, value string) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt([]byte(value), 0)
+	return err
+}
+
+func (l *fileLocker) Refresh(
+	ctx context.Context, db int, ttl time.Duration,
+) error {
+	return nil
+}
+
+func (l *fileLocker) Unlock(ctx context.Context, db int) error {
+	l.mu.Lock()
+	f, ok := l.files[db]
+	delete(l.files, db)
+	l.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	// file is not removed, otherwise other process may lock the new file
+	// while somebody still holds the lock of the removed one
+	if err := f.Truncate(0); err != nil {
+		_ = f.Close()
+		return err
+	}
+	// closing the file releases the lock
+	return f.Close()
+}
+
+func (l *fileLocker) NotifyReleased(ctx context.Context, db int) error {
+	return nil
+}
+
+func (l *fileLocker) Released(
+	ctx context.Context,
+) (<-chan int, func() error, error) {
+	return nil, func() error { return nil }, nil
+}
+
+func (l *fileLocker) Locks(ctx context.Context) ([]LockInfo, error) {
+	files, err := ioutil.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var locks []LockInfo
+	for _, fi := range files {
+		db, ok := parseFlockFileName(fi.Name())
+		if !ok {
+			continue
+		}
+		locked, value, err := l.probe(db)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			locks = append(locks, LockInfo{DB: db, Value: value, TTL: -1})
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].DB < locks[j].DB })
+	return locks, nil
+}
+
+// probe checks if the lock file of db is locked and reads its value.
+func (l *fileLocker) probe(db int) (bool, string, error) {
+	f, err := os.Open(l.path(db))
+	if err != nil {
+		return false, "", err
+	}
+	defer f.Close()
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	if err == nil {
+		// nobody holds exclusive lock
+		return false, "", nil
+	} else if err != syscall.EWOULDBLOCK {
+		return false, "", err
+	}
+
+	value, err := ioutil.ReadAll(f)
+	if err != nil {
+		return false, "", err
+	}
+	return true, string(value), nil
+}
+
+func parseFlockFileName(name string) (int, bool) {
+	prefix := strings.TrimSuffix(flockFileTmpl, "%d.lock")
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".lock") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(
+		strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".lock"))
+	if err != nil || fmt.Sprintf(flockFileTmpl, n) != name {
+		return 0, false
+	}
+	return n, true
+}
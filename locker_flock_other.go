@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package go_test_redis
+
+import (
+	"errors"
+)
+
+// NewFileLocker is not supported on this platform, as it lacks flock(2).
+// It always returns an error.
+func NewFileLocker(dir string) (Locker, error) {
+	return nil, errors.New("file locker is not supported on this platform")
+}
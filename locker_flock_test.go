@@ -0,0 +1,74 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package go_test_redis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFileLocker(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	l1, err := NewFileLocker(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := NewFileLocker(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := l1.TryLock(ctx, 5, "first", time.Minute)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	ok, err = l2.TryLock(ctx, 5, "second", time.Minute)
+	if err != nil || ok {
+		t.Fatal(ok, err)
+	}
+
+	locks, err := l2.Locks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 1 || locks[0].DB != 5 || locks[0].Value != "first" {
+		t.Fatal(locks)
+	}
+
+	if err = unlockDB(ctx, l1, 5); err != nil {
+		t.Fatal(err)
+	}
+	ok, err = l2.TryLock(ctx, 5, "second", time.Minute)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if err = l2.Unlock(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+	if locks, err = l1.Locks(ctx); err != nil || len(locks) != 0 {
+		t.Fatal(locks, err)
+	}
+}
+
+func TestParseFlockFileName(t *testing.T) {
+	testCases := []struct {
+		name string
+		db   int
+		ok   bool
+	}{
+		{"db-3.lock", 3, true},
+		{"db-12.lock", 12, true},
+		{"db-03.lock", 0, false},
+		{"db-x.lock", 0, false},
+		{"other", 0, false},
+	}
+	for _, tc := range testCases {
+		db, ok := parseFlockFileName(tc.name)
+		if db != tc.db || ok != tc.ok {
+			t.Errorf("parseFlockFileName(%q) = %v, %v", tc.name, db, ok)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package go_test_redis
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryLocker struct {
+	mu          sync.Mutex
+	locks       map[int]memoryLock
+	subscribers map[chan int]struct{}
+}
+
+type memoryLock struct {
+	value   string
+	expires time.Time
+}
+
+// NewMemoryLocker returns locker that keeps locks in memory of the current
+// process. It is useful when all tests using redis server are in the same
+// process and for testing.
+func NewMemoryLocker() Locker {
+	return &memoryLocker{
+		locks:       make(map[int]memoryLock),
+		subscribers: make(map[chan int]struct{}),
+	}
+}
+
+func (l *memoryLocker) TryLock(
+	ctx context.Context, db int, value string, ttl time.Duration,
+) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lock, ok := l.locks[db]; ok && time.Now().Before(lock.expires) {
+		return false, nil
+	}
+	l.locks[db] = memoryLock{value: value, expires: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (l *memoryLocker) Refresh(
+	ctx context.Context, db int, ttl time.Duration,
+) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lock, ok := l.locks[db]; ok {
+		lock.expires = time.Now().Add(ttl)
+		l.locks[db] = lock
+	}
+	return nil
+}
+
+func (l *memoryLocker) Unlock(ctx context.Context, db int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.locks, db)
+	return nil
+}
+
+func (l *memoryLocker) NotifyReleased(ctx context.Context, db int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ch := range l.subscribers {
+		select {
+		case ch <- db:
+		default:
+			// subscriber is busy, it would find the database on rescan
+		}
+	}
+	return nil
+}
+
+func (l *memoryLocker) Released(
+	ctx context.Context,
+) (<-chan int, func() error, error) {
+	ch := make(chan int, 16)
+	l.mu.Lock()
+	l.subscribers[ch] = struct{}{}
+	l.mu.Unlock()
+
+	stop := func() error {
+		l.mu.Lock()
+		delete(l.subscribers, ch)
+		l.mu.Unlock()
+		return nil
+	}
+	return ch, stop, nil
+}
+
+func (l *memoryLocker) Locks(ctx context.Context) ([]LockInfo, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	locks := make([]LockInfo, 0, len(l.locks))
+	for db, lock := range l.locks {
+		if !now.Before(lock.expires) {
+			continue
+		}
+		locks = append(locks, LockInfo{
+			DB:    db,
+			Value: lock.value,
+			TTL:   lock.expires.Sub(now),
+		})
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].DB < locks[j].DB })
+	return locks, nil
+}
@@ -0,0 +1,291 @@
+package go_test_redis
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMemoryLocker(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+
+	ok, err := l.TryLock(ctx, 3, "a", time.Minute)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	ok, err = l.TryLock(ctx, 3, "b", time.Minute)
+	if err != nil || ok {
+		t.Fatal(ok, err)
+	}
+
+	locks, err := l.Locks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 1 || locks[0].DB != 3 || locks[0].Value != "a" {
+		t.Fatal(locks)
+	}
+
+	ch, stop, err := l.Released(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if err = unlockDB(ctx, l, 3); err != nil {
+		t.Fatal(err)
+	}
+	if db := <-ch; db != 3 {
+		t.Fatal(db)
+	}
+
+	// expired lock may be taken again
+	ok, err = l.TryLock(ctx, 4, "a", time.Nanosecond)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	time.Sleep(time.Millisecond)
+	ok, err = l.TryLock(ctx, 4, "b", time.Minute)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+}
+
+func TestLockFreeDB(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+	dirty := map[int]bool{1: true}
+	check := func(ctx context.Context, db int) (bool, error) {
+		return !dirty[db], nil
+	}
+
+	if _, err := l.TryLock(ctx, 2, "other", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if db := lockFreeDB(ctx, t, l, []int{1, 2, 3, 4}, "me", check, nil); db != 3 {
+		t.Fatal(db)
+	}
+	// lock of dirty database is released
+	locks, err := l.Locks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 2 || locks[0].DB != 2 || locks[1].DB != 3 {
+		t.Fatal(locks)
+	}
+
+	if db := lockFreeDB(ctx, t, l, []int{1, 2, 3}, "me", check, nil); db != -1 {
+		t.Fatal(db)
+	}
+}
+
+func TestGetOrWaitFreeDB(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+	check := func(ctx context.Context, db int) (bool, error) {
+		return true, nil
+	}
+	for i := 1; i < 3; i++ {
+		if _, err := l.TryLock(ctx, i, "other", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if err := unlockDB(ctx, l, 2); err != nil {
+			t.Error(err)
+		}
+	}()
+	db := getOrWaitFreeDB(ctx, t, l, []int{1, 2}, time.Second, "me",
+		check, nil)
+	if db != 2 {
+		t.Fatal(db)
+	}
+}
+
+func TestNextLockExpiry(t *testing.T) {
+	locks := []LockInfo{
+		{DB: 1, TTL: time.Minute},
+		{DB: 2, TTL: -1},
+		{DB: 3, TTL: time.Second},
+		{DB: 4, TTL: time.Millisecond},
+	}
+	d, ok := nextLockExpiry(locks, []int{1, 2, 3})
+	if !ok || d != time.Second+lockExpiryMargin {
+		t.Fatal(d, ok)
+	}
+	if _, ok = nextLockExpiry(locks, []int{2, 5}); ok {
+		t.Fatal("expected no expiring locks")
+	}
+}
+
+func TestGetOrWaitFreeDBExpiredLock(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+	check := func(ctx context.Context, db int) (bool, error) {
+		return true, nil
+	}
+	if _, err := l.TryLock(ctx, 1, "other", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.TryLock(ctx, 2, "other", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// expiration is not notified, but waiter must not wait for rescan
+	start := time.Now()
+	db := getOrWaitFreeDB(ctx, t, l, []int{1, 2}, time.Second, "me", check,
+		nil)
+	if db != 2 {
+		t.Fatal(db)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatal(elapsed)
+	}
+}
+
+func TestServerLocker(t *testing.T) {
+	// lockers from other servers must not check databases with script
+	if _, ok := NewRedisLocker(nil, "").(serverLocker); ok {
+		t.Fatal("redis locker must not check databases")
+	}
+	if _, ok := newServerLocker(nil, dbConfig{}).(serverLocker); !ok {
+		t.Fatal("locker of the same server must check databases")
+	}
+}
+
+func TestTryLockDirtyDB(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+	check := func(ctx context.Context, db int) (bool, error) {
+		return false, nil
+	}
+
+	// dirty database is quarantined instead of failing the test
+	if tryLockDB(ctx, t, l, 1, "me", check) {
+		t.Fatal("dirty database must not be locked")
+	}
+	locks, err := l.Locks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 0 {
+		t.Fatal(locks)
+	}
+}
+
+func TestRedisLockerReleased(t *testing.T) {
+	newTestServer(t)
+	ctx := context.Background()
+	cli := redis.NewClient(newRedisOpts(0))
+	defer closeOrFatal(t, cli)
+	locker := NewRedisLocker(cli, "")
+
+	ch, stop, err := locker.Released(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = unlockDB(ctx, locker, 3); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case n := <-ch:
+		if n != 3 {
+			t.Fatal(n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("release is not notified")
+	}
+
+	// stop interrupts blocked XREAD and waits for the reader to exit
+	start := time.Now()
+	if err = stop(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d >= releasedPollInterval/2 {
+		t.Fatalf("stop took %v", d)
+	}
+}
+
+func TestLockFreeDBScriptSkipsQuarantined(t *testing.T) {
+	newTestServer(t)
+	ctx := context.Background()
+	cli := redis.NewClient(newRedisOpts(0))
+	defer closeOrFatal(t, cli)
+	dbs := dbConfig{allowed: []int{1, 2, 3}}
+	ns := dbs.namespace
+	l := newServerLocker(cli, dbs).(serverLocker)
+
+	quarantine := func(db int, since time.Time) {
+		t.Helper()
+		dbCli := redis.NewClient(newRedisOpts(db))
+		defer closeOrFatal(t, dbCli)
+		if err := dbCli.Set(ctx, "k", "v", 0).Err(); err != nil {
+			t.Fatal(err)
+		}
+		v, err := json.Marshal(dirtyMarker{Since: since, Keys: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cli.Set(ctx, ns.dirtyKey(db), v, 0).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lockFree := func(policy DirtyPolicy, wantDB int, wantDirty bool) {
+		t.Helper()
+		db, dirty, err := l.lockFreeDB(ctx, dbs.allowed, "me", time.Minute,
+			&policy)
+		if err != nil || db != wantDB || dirty != wantDirty {
+			t.Fatal(db, dirty, err)
+		}
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// foreign database is skipped, kept one is reclaimed
+	quarantine(1, now)
+	quarantine(2, now)
+	if err := cli.Set(ctx, ns.keptKey(2), "", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.TryLock(ctx, 3, "other", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	lockFree(DirtyPolicy{}, 2, true)
+
+	// quarantined databases are not locked while others are busy
+	if err := cli.Del(ctx, ns.keptKey(2)).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Unlock(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	lockFree(DirtyPolicy{}, scriptAllLocked, false)
+
+	// owned databases are reclaimed only if the policy allows
+	if err := l.Unlock(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	quarantine(3, now.Add(-2*time.Hour))
+	if err := cli.SAdd(ctx, ns.ownedKey(), 2, 3).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Set(ctx, ns.leasedKey(2), "", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	lockFree(DirtyPolicy{FlushAfter: 3 * time.Hour}, scriptAllQuarantined,
+		false)
+	lockFree(DirtyPolicy{FlushAfter: time.Hour}, 3, true)
+	lockFree(DirtyPolicy{FlushLeased: true}, 2, true)
+
+	locks, err := l.Locks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 2 || locks[0].DB != 2 || locks[1].DB != 3 {
+		t.Fatal(locks)
+	}
+}
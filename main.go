@@ -5,17 +5,18 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
 )
 
-const broadcastChName = "redis-test-broadcast"
-const lockDBKeyTmpl = "redis-test-%d"
 const lockTimeout = time.Minute * 20
 const waitForDBTimeout = time.Minute
 
@@ -25,13 +26,24 @@ func closeOrFatal(t testing.TB, c io.Closer) {
 	}
 }
 
-func lockKeyFmt(n int) string {
-	return fmt.Sprintf(lockDBKeyTmpl, n)
-}
-
 type testRedisOptions struct {
 	debug            bool
 	waitForDBTimeout time.Duration
+	keepOnFailure    time.Duration
+	dumpDir          string
+	cleanup          Cleanup
+	pool             *Pool
+	dbs              dbConfig
+	locker           Locker
+	dirtyPolicy      DirtyPolicy
+	leakCheck        leakCheckMode
+	tracerProvider   trace.TracerProvider
+	slowlog          bool
+	forbidden        []string
+	isolationWatch   bool
+	memoryBudget     int64
+	memoryBudgetFail bool
+	memoryInterval   time.Duration
 }
 
 type Option func(*testRedisOptions)
@@ -48,166 +60,500 @@ func newRedisOpts(db int) *redis.Options {
 
 // WithRedis return redis client connected to empty redis database.
 // If all databases are busy at the moment, we are waiting up to one minute
-// for empty one. On test exit, we flush all data from redis database.
+// for empty one. On test exit, we flush all data from redis database
+// (see WithCleanup for other ways to clean it) unless the test failed and
+// WithKeepOnFailure option is used. Failed test database may be dumped to
+// file with WithDumpOnFailure option.
 func WithRedis(t testing.TB, opts ...Option) *redis.Client {
 	var op = testRedisOptions{
 		waitForDBTimeout: waitForDBTimeout,
+		keepOnFailure:    keepOnFailureFromEnv(t),
+		dumpDir:          os.Getenv(dumpDirEnv),
+		cleanup:          CleanupFlush(),
+	}
+	var err error
+	if op.dbs, err = dbConfigFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if op.dirtyPolicy, err = dirtyPolicyFromEnv(); err != nil {
+		t.Fatal(err)
 	}
 	for _, setup := range opts {
 		setup(&op)
 	}
 
-	cli := redis.NewClient(newRedisOpts(0))
+	leaseID := newLeaseID()
+	ctlName := leaseClientName(clientKindControl, leaseID, t.Name())
+	leaseName := leaseClientName(clientKindLease, leaseID, t.Name())
+
+	cli := redis.NewClient(
+		withClientName(newRedisOpts(op.dbs.control), ctlName))
 	defer closeOrFatal(t, cli)
+	if err := checkTestServer(context.Background(), cli); err != nil {
+		t.Fatal(err)
+	}
+	locker := op.locker
+	if locker == nil {
+		locker = newServerLocker(cli, op.dbs)
+	}
+
+	if op.tracerProvider == nil {
+		op.tracerProvider = global.TracerProvider()
+	}
+	tracer := op.tracerProvider.Tracer(tracerName)
+	ctx, leaseSpan := tracer.Start(context.Background(), "redis-test.lease",
+		trace.WithAttributes(label.String("test", t.Name()),
+			label.String("lease", leaseID)))
+	// registered first, so it runs after cleanup of the database
+	t.Cleanup(func() {
+		if t.Failed() {
+			leaseSpan.SetStatus(codes.Error, "test failed")
+		}
+		leaseSpan.End()
+	})
 
 	n := databasesNum(t, cli)
-	if n < 2 {
-		t.Fatalf(
-			"Minimal acceptable number of databases on redis should be 2, "+
-				"currently: %v",
-			n,
-		)
+	dbs, err := op.dbs.testDatabases(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaseValue := newLeaseValue(t, leaseID)
+	waitStart := time.Now()
+	chosenDB := func() int {
+		// span is ended on timeout too
+		ctx, span := tracer.Start(ctx, "redis-test.wait")
+		defer span.End()
+		db := getOrWaitFreeDB(ctx, t, locker, dbs, op.waitForDBTimeout,
+			leaseValue, redisDBCheck(t, cli, op.dbs, op.dirtyPolicy),
+			&op.dirtyPolicy)
+		span.SetAttributes(label.Int("db", db))
+		return db
+	}()
+	leasedAt := time.Now()
+	leaseSpan.SetAttributes(label.Int("db", chosenDB))
+	acquireCtx, acquireSpan := tracer.Start(ctx, "redis-test.acquire")
+	metrics := LeaseMetrics{
+		Test: t.Name(), DB: chosenDB, Wait: leasedAt.Sub(waitStart),
+	}
+	// the database is empty, so it may be flushed later; dirty database
+	// with leased marker is known to be left by test
+	_, err = cli.Pipelined(acquireCtx, func(p redis.Pipeliner) error {
+		p.SAdd(acquireCtx, op.dbs.namespace.ownedKey(), chosenDB)
+		p.Set(acquireCtx, op.dbs.namespace.leasedKey(chosenDB), leaseValue,
+			0)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
 	}
-	ctx := context.Background()
-	chosenDB := getOrWaitFreeDB(ctx, t, cli, n, op.waitForDBTimeout)
 	if op.debug {
-		t.Logf("Number of databases: %v, chosen: %v", n, chosenDB)
+		t.Logf("Number of databases: %v, test databases: %v, chosen: %v",
+			n, len(dbs), chosenDB)
 	}
 
-	chosenCli := redis.NewClient(newRedisOpts(chosenDB))
+	if op.pool != nil {
+		op.pool.acquire(acquireCtx, t, chosenDB)
+	}
+	acquireSpan.End()
+
+	// control client of this function is closed on return
+	refreshCtl := redis.NewClient(
+		withClientName(newRedisOpts(op.dbs.control), ctlName))
+	refreshLocker := op.locker
+	if refreshLocker == nil {
+		refreshLocker = newServerLocker(refreshCtl, op.dbs)
+	}
+	stopRefresh := refreshLease(refreshLocker, chosenDB, lockTimeout/4)
+
+	chosenCli := redis.NewClient(
+		withClientName(newRedisOpts(chosenDB), leaseName))
+	// queries of this package are not traced and not forbidden
 	if op.debug {
 		t.Logf("Return redis cli with DB = %v", currentDB(ctx, t, chosenCli))
 	}
+	chosenCli.AddHook(tracingHook{tracer: tracer, lease: leaseSpan})
+	if len(op.forbidden) != 0 {
+		chosenCli.AddHook(newForbidHook(t, op.forbidden))
+	}
 
+	var slowlog slowlogMark
+	if op.slowlog {
+		// the database is locked already, it must reach the cleanup
+		if slowlog, err = markSlowlog(ctx, cli); err != nil {
+			t.Errorf("can't mark slow redis commands: %v", err)
+			op.slowlog = false
+		}
+	}
+
+	var watch *isolationWatch
+	if op.isolationWatch {
+		watch = watchIsolation(ctx, t,
+			withClientName(newRedisOpts(op.dbs.control), ctlName),
+			chosenDB, dbs, leaseName)
+	}
+
+	var memory *memoryWatch
+	if op.memoryBudget > 0 {
+		memory = watchMemory(t,
+			withClientName(newRedisOpts(chosenDB), ctlName),
+			op.memoryBudget, op.memoryBudgetFail, op.memoryInterval)
+	}
+
+	leaseMetrics.leased()
 	t.Cleanup(func() {
 		if op.debug {
 			t.Logf("Release redis cli %v", chosenDB)
 		}
-		ctx := context.Background()
+		ctx, cleanupSpan := tracer.Start(ctx, "redis-test.cleanup")
+		defer cleanupSpan.End()
+		defer func() {
+			metrics.Held = time.Since(leasedAt)
+			metrics.Failed = t.Failed()
+			leaseMetrics.released(metrics)
+		}()
+
+		// the lock may be still held, the database is cleaned anyway
+		if err := stopRefresh(); err != nil {
+			t.Error(err)
+		}
+		if err := refreshCtl.Close(); err != nil {
+			t.Error(err)
+		}
 
-		if err := chosenCli.FlushDB(ctx).Err(); err != nil {
-			// we should not stop here and delete lock key
-			t.Errorf("can't flush db: %+v", err)
+		if memory != nil {
+			// the database must be cleaned anyway
+			peak, err := memory.stop()
+			if err != nil {
+				t.Error(err)
+			} else if op.debug {
+				t.Logf("Peak memory usage of redis db %v: %v bytes in %v keys",
+					chosenDB, peak.Bytes, peak.Keys)
+			}
 		}
 
-		conn := chosenCli.Conn(ctx)
-		defer closeOrFatal(t, conn)
-		if err := conn.Select(ctx, 0).Err(); err != nil {
-			t.Fatal(err)
+		if op.leakCheck != leakCheckOff {
+			checkPoolLeaks(t, op.leakCheck, chosenCli)
 		}
-		if err := conn.Del(ctx, lockKeyFmt(chosenDB)).Err(); err != nil {
-			t.Fatal(err)
+
+		// the returned client carries hooks of the test, so the database
+		// is inspected with a client of its own
+		inspectCli := redis.NewClient(
+			withClientName(newRedisOpts(chosenDB), ctlName))
+		if op.dumpDir != "" && t.Failed() {
+			dumpOnFailure(ctx, t, inspectCli, op.dumpDir, chosenDB,
+				leaseID)
 		}
 
-		err := conn.Publish(ctx, broadcastChName, strconv.Itoa(chosenDB)).Err()
+		keys, err := inspectCli.DBSize(ctx).Result()
 		if err != nil {
 			t.Fatal(err)
 		}
+		metrics.Keys = keys
 
+		checkIsolation(ctx, t, inspectCli, chosenDB, leaseName)
+		closeOrFatal(t, inspectCli)
+		if watch != nil {
+			breaches, err := watch.stop()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(breaches) != 0 {
+				t.Errorf("test changed databases of other tests:\n%v",
+					strings.Join(breaches, "\n"))
+			}
+		}
+
+		addr := chosenCli.Options().Addr
 		closeOrFatal(t, chosenCli)
+
+		ctl := redis.NewClient(
+			withClientName(newRedisOpts(op.dbs.control), ctlName))
+		defer closeOrFatal(t, ctl)
+		locker := op.locker
+		if locker == nil {
+			locker = newServerLocker(ctl, op.dbs)
+		}
+
+		if op.leakCheck != leakCheckOff {
+			checkClientLeaks(ctx, t, op.leakCheck, ctl, chosenDB, leaseName)
+		}
+
+		if op.slowlog {
+			// logging must not prevent cleanup of the database
+			err := reportSlowlog(ctx, t, ctl, slowlog, leaseName)
+			if err != nil {
+				t.Errorf("can't report slow redis commands: %v", err)
+			}
+		}
+
+		if op.keepOnFailure > 0 && t.Failed() {
+			keepDB(ctx, t, ctl, locker, op.dbs.namespace, addr, chosenDB,
+				op.keepOnFailure)
+			return
+		}
+
+		cleanupStart := time.Now()
+		leasedKey := op.dbs.namespace.leasedKey(chosenDB)
+		if op.pool != nil && op.pool.release(ctx, t, chosenDB, leasedKey) {
+			metrics.Cleanup = time.Since(cleanupStart)
+			return
+		}
+
+		dbCli := redis.NewClient(
+			withClientName(newRedisOpts(chosenDB), ctlName))
+		cleanupCtx := withCleanupEnv(ctx, cleanupEnv{locker, op.dbs})
+		err = op.cleanup(cleanupCtx, dbCli, chosenDB)
+		if err != nil {
+			// we should not stop here and delete lock key
+			t.Errorf("can't cleanup db: %+v", err)
+		} else if err := ctl.Del(ctx, leasedKey).Err(); err != nil {
+			t.Fatal(err)
+		}
+		closeOrFatal(t, dbCli)
+		metrics.Cleanup = time.Since(cleanupStart)
+		if op.debug {
+			t.Logf("Cleanup of redis db %v took %v",
+				chosenDB, metrics.Cleanup)
+		}
+
+		if err := unlockDB(ctx, locker, chosenDB); err != nil {
+			t.Fatal(err)
+		}
 	})
 
 	return chosenCli
 }
 
 func getOrWaitFreeDB(
-	ctx context.Context, t testing.TB, cli *redis.Client, dbsNum int,
-	timeout time.Duration,
+	ctx context.Context, t testing.TB, locker Locker, dbs []int,
+	timeout time.Duration, lockValue string, check dbCheck,
+	policy *DirtyPolicy,
 ) int {
-	pubsub := cli.Subscribe(ctx, broadcastChName)
-	defer closeOrFatal(t, pubsub)
+	ch, stop, err := locker.Released(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
 
-	ch := pubsub.Channel()
 	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
 	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 	var chosenDB int
 
+	// rescan databases right after the first lock expires, expiration is
+	// not notified
+	var expiry *time.Timer
+	var expiryC <-chan time.Time
+	scheduleExpiry := func() {
+		locks, err := locker.Locks(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expiry != nil {
+			expiry.Stop()
+		}
+		expiryC = nil
+		if d, ok := nextLockExpiry(locks, dbs); ok {
+			expiry = time.NewTimer(d)
+			expiryC = expiry.C
+		}
+	}
+	defer func() {
+		if expiry != nil {
+			expiry.Stop()
+		}
+	}()
+
 	// find free database
-	chosenDB = lockFreeDB(ctx, t, cli, dbsNum)
-	if chosenDB > 0 {
+	chosenDB = lockFreeDB(ctx, t, locker, dbs, lockValue, check, policy)
+	if chosenDB >= 0 {
 		return chosenDB
 	}
+	scheduleExpiry()
 
+	// events of waiting are added to the span of the caller, if any
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent(ctx, "all databases locked")
 	for {
 		select {
-		case msg := <-ch:
+		case n := <-ch:
+			span.AddEvent(ctx, "released", label.Int("db", n))
 			// check if freed database is actually free and can be locked
-			n, err := strconv.Atoi(msg.Payload)
-			if err != nil {
-				t.Fatal(err)
+			if !containsDB(dbs, n) {
+				// released by test with other databases configuration
+				continue
 			}
-			if tryLockDB(ctx, t, cli, n) {
+			if tryLockDB(ctx, t, locker, n, lockValue, check) {
 				return n
 			}
 		case <-ticker.C:
+			span.AddEvent(ctx, "rescan")
 			// rescan all databases, may be we will find empty one
-			chosenDB = lockFreeDB(ctx, t, cli, dbsNum)
-			if chosenDB > 0 {
+			chosenDB = lockFreeDB(ctx, t, locker, dbs, lockValue, check, policy)
+			if chosenDB >= 0 {
 				return chosenDB
 			}
+			scheduleExpiry()
+		case <-expiryC:
+			span.AddEvent(ctx, "lock expired")
+			chosenDB = lockFreeDB(ctx, t, locker, dbs, lockValue, check, policy)
+			if chosenDB >= 0 {
+				return chosenDB
+			}
+			scheduleExpiry()
 		case <-timer.C:
+			span.SetStatus(codes.Error, "timeout")
 			t.Fatal("wait for free database timeout")
 		}
 	}
 }
 
-func tryLockDB(ctx context.Context, t testing.TB, cli *redis.Client, db int) bool {
-	conn := cli.Conn(ctx)
-	defer closeOrFatal(t, conn)
+// lockExpiryMargin is added to lock TTL, so the lock is surely expired when
+// waiter tries to take it.
+const lockExpiryMargin = 10 * time.Millisecond
+
+// nextLockExpiry returns time left before the first lock of databases dbs
+// expires. Returns false if there are no expiring locks.
+func nextLockExpiry(locks []LockInfo, dbs []int) (time.Duration, bool) {
+	var next time.Duration
+	found := false
+	for _, l := range locks {
+		if l.TTL < 0 || !containsDB(dbs, l.DB) {
+			continue
+		}
+		if !found || l.TTL < next {
+			next = l.TTL
+			found = true
+		}
+	}
+	return next + lockExpiryMargin, found
+}
+
+// dbCheck reports if database db locked by us is clean and may be used by
+// test. It may clean the database if it is safe to do.
+type dbCheck func(ctx context.Context, db int) (bool, error)
+
+// redisDBCheck returns dbCheck that checks that database is empty. Dirty
+// database is reclaimed if it was kept after failed test or is quarantined
+// and repaired according to the policy. cli must be connected to the
+// control database.
+func redisDBCheck(
+	t testing.TB, cli *redis.Client, dbs dbConfig, policy DirtyPolicy,
+) dbCheck {
+	return func(ctx context.Context, db int) (bool, error) {
+		conn := cli.Conn(ctx)
+		defer closeOrFatal(t, conn)
+
+		if err := conn.Select(ctx, db).Err(); err != nil {
+			return false, err
+		}
+		err := conn.RandomKey(ctx).Err()
+		if err != nil && err != redis.Nil {
+			return false, err
+		}
+		clean := err == redis.Nil
+		if err = conn.Select(ctx, dbs.control).Err(); err != nil {
+			return false, err
+		}
+		if clean {
+			// database might be flushed by hand after quarantine
+			err = conn.Del(ctx, dbs.namespace.dirtyKey(db)).Err()
+			return err == nil, err
+		}
+		if reclaimKeptDB(ctx, t, conn, dbs, db) {
+			return true, nil
+		}
+		return repairDirtyDB(ctx, t, conn, dbs, policy, db)
+	}
+}
 
-	now := time.Now().Format(time.RFC3339)
-	ok, err := conn.SetNX(ctx, lockKeyFmt(db), now, lockTimeout).Result()
+func tryLockDB(
+	ctx context.Context, t testing.TB, locker Locker, db int,
+	lockValue string, check dbCheck,
+) bool {
+	ok, err := locker.TryLock(ctx, db, lockValue, lockTimeout)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if ok {
-		r, err := conn.Select(ctx, db).Result()
+		clean, err := check(ctx, db)
 		if err != nil {
 			t.Fatal(err)
 		}
-		t.Logf("select result [3]: %v", r)
-		r, err = conn.RandomKey(ctx).Result()
-		if err == redis.Nil {
+		if clean {
 			return true
-		} else if err != nil {
-			t.Fatal(err)
 		}
-		t.Fatalf(
-			"expected clean database after lock released: %v, but found key %v",
-			db, r,
-		)
+		// database released dirty is quarantined, look for other ones
+		if err = locker.Unlock(ctx, db); err != nil {
+			t.Fatalf("can't release lock of dirty database: %v", err)
+		}
 	}
 	return false
 }
 
+// With server locker, dirty databases that may be reclaimed under policy are
+// locked and checked by the lock script, quarantined ones are skipped. Nil
+// policy disables reclaiming.
+//
 // return:
 //  -1 if no db chosen
 func lockFreeDB(
-	ctx context.Context, t testing.TB, cli *redis.Client, dbsNum int,
+	ctx context.Context, t testing.TB, locker Locker, dbs []int,
+	lockValue string, check dbCheck, policy *DirtyPolicy,
 ) int {
-	conn := cli.Conn(ctx)
-	defer closeOrFatal(t, conn)
+	if sl, ok := locker.(serverLocker); ok {
+		// database that was not repaired by check may be returned again,
+		// so the number of attempts is limited
+		for range dbs {
+			db, dirty, err := sl.lockFreeDB(ctx, dbs, lockValue,
+				lockTimeout, policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case db == scriptAllLocked:
+				return -1
+			case db == scriptAllQuarantined:
+				fatalAllDirty(t, dbs)
+			case !dirty:
+				return db
+			}
+			clean, err := check(ctx, db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if clean {
+				return db
+			}
+			if err = locker.Unlock(ctx, db); err != nil {
+				t.Fatalf("can't release lock of dirty database: %v", err)
+			}
+		}
+		return -1
+	}
 
 	var foundLockedDatabases = false
-	for i := 1; i < dbsNum; i++ {
-		now := time.Now().Format(time.RFC3339)
-		ok, err := conn.SetNX(ctx, lockKeyFmt(i), now, lockTimeout).Result()
+	var dirty []int
+	for _, i := range dbs {
+		ok, err := locker.TryLock(ctx, i, lockValue, lockTimeout)
 		if err != nil {
 			t.Fatal(err)
 		}
 		if ok {
-			if err = conn.Select(ctx, i).Err(); err != nil {
+			clean, err := check(ctx, i)
+			if err != nil {
 				t.Fatal(err)
 			}
-			if err = conn.RandomKey(ctx).Err(); err == redis.Nil {
+			if clean {
 				return i
-			} else if err != nil {
-				t.Fatal(err)
-			}
-			if err = conn.Select(ctx, 0).Err(); err != nil {
-				t.Fatal(err)
 			}
-			if err = conn.Del(ctx, lockKeyFmt(i)).Err(); err != nil {
+			dirty = append(dirty, i)
+			if err = locker.Unlock(ctx, i); err != nil {
 				t.Fatalf("can't release lock of dirty database: %v", err)
 			}
 		} else {
@@ -216,13 +562,26 @@ func lockFreeDB(
 	}
 
 	if !foundLockedDatabases {
-		t.Fatal("clean databases not found, try to flush few databases")
+		fatalAllDirty(t, dirty)
 	}
 
 	return -1
 }
 
-var clientLineIDRegex = regexp.MustCompile(`^id=(\d+) .* db=(\d+) .*$`)
+func fatalAllDirty(t testing.TB, dirty []int) {
+	t.Fatalf("clean databases not found, databases %v are dirty and "+
+		"quarantined: flush them with `go-test-redis reset` or set "+
+		"the policy with WithDirtyPolicy", dirty)
+}
+
+func containsDB(dbs []int, db int) bool {
+	for _, n := range dbs {
+		if n == db {
+			return true
+		}
+	}
+	return false
+}
 
 // Get currently connected database
 func currentDB(ctx context.Context, t testing.TB, cli *redis.Client) int {
@@ -244,24 +603,14 @@ func currentDB(ctx context.Context, t testing.TB, cli *redis.Client) int {
 	if err != nil {
 		t.Fatal(err)
 	}
-	for _, statusLn := range strings.Split(clientList, "\n") {
-		res := clientLineIDRegex.FindStringSubmatch(statusLn)
-		if len(res) != 3 {
-			continue
-		}
-		currentID, err := strconv.Atoi(res[1])
-		if err != nil {
-			t.Fatal(err)
-		}
-		if int64(currentID) != clientID {
-			continue
-		}
-
-		dbNum, err := strconv.Atoi(res[2])
-		if err != nil {
-			t.Fatal(err)
+	clients, err := parseClientList(clientList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range clients {
+		if c.ID == clientID {
+			return c.DB
 		}
-		return dbNum
 	}
 
 	t.Fatal("[assertion] can't find self client line")
@@ -269,28 +618,38 @@ func currentDB(ctx context.Context, t testing.TB, cli *redis.Client) int {
 }
 
 func databasesNum(t testing.TB, cli *redis.Client) int {
-	paramDatabases := "databases"
-	res, err := cli.ConfigGet(context.Background(), paramDatabases).Result()
+	n, err := getDatabasesNum(context.Background(), cli)
 	if err != nil {
 		t.Fatal(err)
 	}
+	return n
+}
+
+func getDatabasesNum(ctx context.Context, cli redis.Cmdable) (int, error) {
+	paramDatabases := "databases"
+	res, err := cli.ConfigGet(ctx, paramDatabases).Result()
+	if err != nil {
+		return 0, err
+	}
 	if len(res) != 2 {
-		t.Fatalf("unexpected number of returned arguments: %v", len(res))
+		return 0, fmt.Errorf(
+			"unexpected number of returned arguments: %v", len(res))
 	}
 	paramName, ok := res[0].(string)
 	if !ok || paramName != paramDatabases {
-		t.Fatalf(
+		return 0, fmt.Errorf(
 			"unexpected parameter name: %v, expected %v",
 			res[0], paramDatabases,
 		)
 	}
 	paramVal, ok := res[1].(string)
 	if !ok {
-		t.Fatalf("expected param value to be string(%[1]T %[1]v)", res[1])
+		return 0, fmt.Errorf(
+			"expected param value to be string(%[1]T %[1]v)", res[1])
 	}
 	i, err := strconv.ParseUint(paramVal, 10, 16)
 	if err != nil {
-		t.Fatal(err)
+		return 0, err
 	}
-	return int(i)
+	return int(i), nil
 }
@@ -0,0 +1,248 @@
+package go_test_redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// defaultMemorySampleInterval is the default interval of sampling memory
+// usage of the leased database.
+const defaultMemorySampleInterval = time.Second
+
+// memorySampleKeys is the maximum number of keys measured with MEMORY USAGE
+// in one sample, memory usage of larger databases is extrapolated from
+// random keys.
+const memorySampleKeys = 100
+
+// memoryUsageSamples is the number of nested values MEMORY USAGE looks at
+// for aggregate types, so large keys are measured in bounded time.
+const memoryUsageSamples = 5
+
+// WithMemoryBudget limits memory used by keys of the leased database to
+// bytes, so tests writing huge datasets do not push the shared server into
+// OOM. Memory usage is sampled every second (see WithMemorySampleInterval)
+// while the test is running and at cleanup. If failTest is true, the test
+// fails when the budget is exceeded, otherwise it is only logged. Peak
+// memory usage is logged with WithDebug option.
+func WithMemoryBudget(bytes int64, failTest bool) Option {
+	return func(o *testRedisOptions) {
+		o.memoryBudget = bytes
+		o.memoryBudgetFail = failTest
+	}
+}
+
+// WithMemorySampleInterval sets the interval of sampling memory usage for
+// WithMemoryBudget option. Every sample measures up to 100 keys. Zero
+// interval means the default one second.
+func WithMemorySampleInterval(interval time.Duration) Option {
+	return func(o *testRedisOptions) {
+		o.memoryInterval = interval
+	}
+}
+
+// memorySample is memory usage of the database.
+type memorySample struct {
+	Keys  int64
+	Bytes int64
+}
+
+// sampleMemory measures memory usage of keys of the database cli is
+// connected to. Only up to memorySampleKeys keys are measured.
+func sampleMemory(
+	ctx context.Context, cli *redis.Client,
+) (memorySample, error) {
+	var s memorySample
+	var err error
+	if s.Keys, err = cli.DBSize(ctx).Result(); err != nil {
+		return s, err
+	}
+	keys, err := sampleKeys(ctx, cli, s.Keys)
+	if err != nil || len(keys) == 0 {
+		return s, err
+	}
+
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err = cli.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, k := range keys {
+			cmds[i] = p.MemoryUsage(ctx, k, memoryUsageSamples)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return s, err
+	}
+	var sum int64
+	for _, cmd := range cmds {
+		n, err := cmd.Result()
+		if err == redis.Nil {
+			// key was deleted after it was sampled
+			continue
+		} else if err != nil {
+			return s, err
+		}
+		sum += n
+	}
+	s.Bytes = estimateMemory(sum, len(keys), s.Keys)
+	return s, nil
+}
+
+// sampleKeys returns up to memorySampleKeys keys of the database of size
+// keys: all of them if the database is small, random ones otherwise.
+func sampleKeys(
+	ctx context.Context, cli *redis.Client, size int64,
+) ([]string, error) {
+	if size <= memorySampleKeys {
+		var keys []string
+		iter := cli.Scan(ctx, 0, "", memorySampleKeys).Iterator()
+		for len(keys) < memorySampleKeys && iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		return keys, iter.Err()
+	}
+
+	cmds := make([]*redis.StringCmd, memorySampleKeys)
+	_, err := cli.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i := range cmds {
+			cmds[i] = p.RandomKey(ctx)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		k, err := cmd.Result()
+		if err == redis.Nil {
+			// database was flushed after DBSIZE
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// estimateMemory extrapolates memory usage sum of sampled keys to all keys
+// of the database.
+func estimateMemory(sum int64, sampled int, keys int64) int64 {
+	if sampled == 0 || keys <= int64(sampled) {
+		return sum
+	}
+	return sum / int64(sampled) * keys
+}
+
+// memoryWatch samples memory usage of the leased database in background.
+type memoryWatch struct {
+	t        testing.TB
+	cli      *redis.Client
+	budget   int64
+	fail     bool
+	interval time.Duration
+	stopCh   chan struct{}
+	done     chan struct{}
+	mu       sync.Mutex
+	peak     memorySample
+	exceeded bool
+	err      error
+}
+
+// watchMemory starts sampling memory usage of the database with client
+// options opts every interval.
+func watchMemory(
+	t testing.TB, opts *redis.Options, budget int64, fail bool,
+	interval time.Duration,
+) *memoryWatch {
+	if interval <= 0 {
+		interval = defaultMemorySampleInterval
+	}
+	w := &memoryWatch{
+		t:        t,
+		cli:      redis.NewClient(opts),
+		budget:   budget,
+		fail:     fail,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stopCh:
+				return
+			case <-ticker.C:
+				w.sample(context.Background())
+			}
+		}
+	}()
+	return w
+}
+
+func (w *memoryWatch) sample(ctx context.Context) {
+	// slow sample must not delay the next one
+	ctx, cancel := context.WithTimeout(ctx, w.interval)
+	defer cancel()
+	s, err := sampleMemory(ctx, w.cli)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if isTimeout(err) {
+		// busy server, the next sample may succeed
+		return
+	} else if err != nil {
+		if w.err == nil {
+			w.err = err
+		}
+		return
+	}
+	if s.Bytes > w.peak.Bytes {
+		w.peak = s
+	}
+	if s.Bytes <= w.budget || w.exceeded {
+		return
+	}
+	// reported once, as soon as possible; t.Errorf and t.Logf may be called
+	// from other goroutines while the test is running
+	w.exceeded = true
+	format := "redis database uses %v bytes in %v keys, memory budget " +
+		"is %v bytes"
+	if w.fail {
+		w.t.Errorf(format, s.Bytes, s.Keys, w.budget)
+	} else {
+		w.t.Logf(format, s.Bytes, s.Keys, w.budget)
+	}
+}
+
+// isTimeout reports if err is a timeout of the sample context or of the
+// connection.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// stop takes the last sample and returns peak memory usage.
+func (w *memoryWatch) stop() (memorySample, error) {
+	close(w.stopCh)
+	<-w.done
+	w.sample(context.Background())
+	err := w.cli.Close()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		err = fmt.Errorf("can't sample memory usage: %w", w.err)
+	}
+	return w.peak, err
+}
@@ -0,0 +1,101 @@
+package go_test_redis
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestEstimateMemory(t *testing.T) {
+	testCases := []struct {
+		sum     int64
+		sampled int
+		keys    int64
+		want    int64
+	}{
+		{0, 0, 0, 0},
+		{500, 10, 10, 500},
+		// keys were added after DBSIZE
+		{600, 12, 10, 600},
+		{1000, 10, 100, 10000},
+	}
+	for _, tc := range testCases {
+		got := estimateMemory(tc.sum, tc.sampled, tc.keys)
+		if got != tc.want {
+			t.Errorf("estimateMemory(%v, %v, %v) = %v, want %v",
+				tc.sum, tc.sampled, tc.keys, got, tc.want)
+		}
+	}
+}
+
+func TestSampleKeys(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	cli := redis.NewClient(newRedisOpts(1))
+	defer closeOrFatal(t, cli)
+
+	// small database is measured completely
+	for i := 0; i < 5; i++ {
+		s.DB(1).Set("k"+strconv.Itoa(i), "v")
+	}
+	keys, err := sampleKeys(ctx, cli, 5)
+	if err != nil || len(keys) != 5 {
+		t.Fatal(keys, err)
+	}
+
+	// large database is sampled with bounded number of keys
+	for i := 5; i < 10*memorySampleKeys; i++ {
+		s.DB(1).Set("k"+strconv.Itoa(i), "v")
+	}
+	keys, err = sampleKeys(ctx, cli, 10*memorySampleKeys)
+	if err != nil || len(keys) != memorySampleKeys {
+		t.Fatal(len(keys), err)
+	}
+	for _, k := range keys {
+		if !s.DB(1).Exists(k) {
+			t.Fatalf("unknown key %q", k)
+		}
+	}
+}
+
+func TestWithMemorySampleInterval(t *testing.T) {
+	var o testRedisOptions
+	WithMemorySampleInterval(time.Minute)(&o)
+	if o.memoryInterval != time.Minute {
+		t.Fatal(o.memoryInterval)
+	}
+
+	newTestServer(t)
+	w := watchMemory(t, newRedisOpts(1), 1, false, 0)
+	if w.interval != defaultMemorySampleInterval {
+		t.Fatal(w.interval)
+	}
+	if _, err := w.stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryWatchErrors(t *testing.T) {
+	s := newTestServer(t)
+
+	// samples timed out on busy server are skipped
+	w := watchMemory(t, newRedisOpts(1), 1, false, time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(),
+		time.Now().Add(-time.Second))
+	defer cancel()
+	w.sample(ctx)
+	if _, err := w.stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	w = watchMemory(t, newRedisOpts(1), 1, false, time.Minute)
+	s.SetError("ERR oops")
+	_, err := w.stop()
+	s.SetError("")
+	if err == nil {
+		t.Fatal("sampling error is not reported")
+	}
+}
@@ -0,0 +1,199 @@
+package go_test_redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// reportFileEnv is the name of environment variable with the path of JSON
+// file RunWithReport writes the report to.
+const reportFileEnv = "REDISTEST_REPORT"
+
+// reportTopN is the number of tests holding databases longest printed in
+// text report.
+const reportTopN = 5
+
+// LeaseMetrics describes one lease of test database.
+type LeaseMetrics struct {
+	Test string `json:"test"`
+	DB   int    `json:"db"`
+	// Wait is the time test waited for free database.
+	Wait time.Duration `json:"wait"`
+	// Held is the time from lease of the database to its release.
+	Held time.Duration `json:"held"`
+	// Cleanup is the time spent to clean the database on release.
+	Cleanup time.Duration `json:"cleanup"`
+	// Keys is the number of keys in the database at cleanup.
+	Keys   int64 `json:"keys"`
+	Failed bool  `json:"failed"`
+}
+
+// LeaseStats aggregates one metric of leases.
+type LeaseStats struct {
+	Total time.Duration `json:"total"`
+	Max   time.Duration `json:"max"`
+	// MaxTest is the test with the maximum value.
+	MaxTest string `json:"max_test,omitempty"`
+}
+
+func (s *LeaseStats) add(d time.Duration, test string) {
+	s.Total += d
+	if d > s.Max || s.MaxTest == "" {
+		s.Max = d
+		s.MaxTest = test
+	}
+}
+
+// Report aggregates metrics of leases made by WithRedis in the current
+// process.
+type Report struct {
+	Leases []LeaseMetrics `json:"leases"`
+	// PeakConcurrent is the maximum number of databases leased at once.
+	PeakConcurrent int        `json:"peak_concurrent"`
+	Wait           LeaseStats `json:"wait"`
+	Held           LeaseStats `json:"held"`
+	Cleanup        LeaseStats `json:"cleanup"`
+}
+
+type leaseRegistry struct {
+	mu     sync.Mutex
+	leases []LeaseMetrics
+	active int
+	peak   int
+}
+
+var leaseMetrics leaseRegistry
+
+func (r *leaseRegistry) leased() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active++
+	if r.active > r.peak {
+		r.peak = r.active
+	}
+}
+
+func (r *leaseRegistry) released(m LeaseMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active--
+	r.leases = append(r.leases, m)
+}
+
+// LeaseReport returns metrics of leases made by WithRedis in the current
+// process so far.
+func LeaseReport() Report {
+	leaseMetrics.mu.Lock()
+	leases := make([]LeaseMetrics, len(leaseMetrics.leases))
+	copy(leases, leaseMetrics.leases)
+	peak := leaseMetrics.peak
+	leaseMetrics.mu.Unlock()
+	return newReport(leases, peak)
+}
+
+func newReport(leases []LeaseMetrics, peak int) Report {
+	r := Report{Leases: leases, PeakConcurrent: peak}
+	for _, l := range leases {
+		r.Wait.add(l.Wait, l.Test)
+		r.Held.add(l.Held, l.Test)
+		r.Cleanup.add(l.Cleanup, l.Test)
+	}
+	return r
+}
+
+// WriteJSON writes report as JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes summary of the report and tests holding databases
+// longest.
+func (r Report) WriteText(w io.Writer) error {
+	_, err := fmt.Fprintf(w,
+		"redis test databases: %v leases, peak concurrent: %v\n",
+		len(r.Leases), r.PeakConcurrent)
+	if err != nil || len(r.Leases) == 0 {
+		return err
+	}
+
+	stats := []struct {
+		name string
+		s    LeaseStats
+	}{{"wait", r.Wait}, {"held", r.Held}, {"cleanup", r.Cleanup}}
+	for _, s := range stats {
+		_, err = fmt.Fprintf(w, "  %-8v total %v, max %v (%v)\n",
+			s.name+":", s.s.Total, s.s.Max, s.s.MaxTest)
+		if err != nil {
+			return err
+		}
+	}
+
+	leases := make([]LeaseMetrics, len(r.Leases))
+	copy(leases, r.Leases)
+	sort.SliceStable(leases, func(i, j int) bool {
+		return leases[i].Held > leases[j].Held
+	})
+	if len(leases) > reportTopN {
+		leases = leases[:reportTopN]
+	}
+	if _, err = fmt.Fprintln(w, "  held longest:"); err != nil {
+		return err
+	}
+	for _, l := range leases {
+		_, err = fmt.Fprintf(w, "    %v %v (db %v, %v keys, waited %v)\n",
+			l.Held, l.Test, l.DB, l.Keys, l.Wait)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunWithReport runs tests and prints report of leases of test databases to
+// stdout. If REDISTEST_REPORT environment variable is set, the report is
+// written as JSON to the file it points to. It is intended to be called
+// from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(go_test_redis.RunWithReport(m))
+//	}
+func RunWithReport(m *testing.M) int {
+	code := m.Run()
+
+	r := LeaseReport()
+	if len(r.Leases) != 0 {
+		if err := r.WriteText(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	if path := os.Getenv(reportFileEnv); path != "" {
+		if err := writeReportFile(path, r); err != nil {
+			fmt.Fprintf(os.Stderr, "can't write redis report: %v\n", err)
+			if code == 0 {
+				code = 1
+			}
+		}
+	}
+	return code
+}
+
+func writeReportFile(path string, r Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = r.WriteJSON(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,43 @@
+package go_test_redis
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	r := newReport([]LeaseMetrics{
+		{Test: "TestA", DB: 1, Wait: time.Second, Held: 2 * time.Second,
+			Cleanup: 10 * time.Millisecond, Keys: 3},
+		{Test: "TestB", DB: 2, Held: 5 * time.Second,
+			Cleanup: 30 * time.Millisecond, Keys: 100},
+	}, 2)
+
+	if r.Wait.Total != time.Second || r.Wait.MaxTest != "TestA" {
+		t.Fatal(r.Wait)
+	}
+	if r.Held.Total != 7*time.Second || r.Held.Max != 5*time.Second ||
+		r.Held.MaxTest != "TestB" {
+
+		t.Fatal(r.Held)
+	}
+	if r.Cleanup.Max != 30*time.Millisecond {
+		t.Fatal(r.Cleanup)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "2 leases, peak concurrent: 2") {
+		t.Fatal(out)
+	}
+	// tests holding databases longest go first
+	b, a := strings.Index(out, "5s TestB"), strings.Index(out, "2s TestA")
+	if b < 0 || a < 0 || b > a {
+		t.Fatal(out)
+	}
+}
@@ -0,0 +1,86 @@
+package go_test_redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// clientNamePrefix starts names of all connections made by this package.
+const clientNamePrefix = "go-test-redis"
+
+// Kinds of connections used in connection names.
+const (
+	clientKindLease   = "lease"
+	clientKindControl = "control"
+	clientKindWait    = "wait"
+	clientKindPool    = "pool"
+)
+
+// newLeaseID returns random identifier of the lease.
+func newLeaseID() string {
+	var b [6]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// testPackageName returns the name of the package under test derived from
+// test binary name, like "cache" for "cache.test".
+func testPackageName() string {
+	name := filepath.Base(os.Args[0])
+	name = strings.TrimSuffix(name, ".exe")
+	return strings.TrimSuffix(name, ".test")
+}
+
+// leaseClientName returns name of connections of the lease, like
+// go-test-redis:lease:5f1c9a0b3e2d:cache:TestCache/sub.
+func leaseClientName(kind, leaseID, testName string) string {
+	return sanitizeClientName(strings.Join([]string{
+		clientNamePrefix, kind, leaseID, testPackageName(), testName,
+	}, ":"))
+}
+
+// leaseIDFromClientName returns lease ID from connection name or empty
+// string if connection does not belong to any lease.
+func leaseIDFromClientName(name string) string {
+	parts := strings.SplitN(name, ":", 4)
+	if len(parts) < 3 || parts[0] != clientNamePrefix {
+		return ""
+	}
+	if parts[1] != clientKindLease && parts[1] != clientKindControl {
+		return ""
+	}
+	return parts[2]
+}
+
+// sanitizeClientName replaces characters not allowed by CLIENT SETNAME.
+func sanitizeClientName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < '!' || r > '~' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// withClientName makes all connections created with opts to be named.
+func withClientName(opts *redis.Options, name string) *redis.Options {
+	onConnect := opts.OnConnect
+	opts.OnConnect = func(ctx context.Context, cn *redis.Conn) error {
+		if err := cn.ClientSetName(ctx, name).Err(); err != nil {
+			return err
+		}
+		if onConnect != nil {
+			return onConnect(ctx, cn)
+		}
+		return nil
+	}
+	return opts
+}
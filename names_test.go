@@ -0,0 +1,33 @@
+package go_test_redis
+
+import (
+	"testing"
+)
+
+func TestLeaseClientName(t *testing.T) {
+	name := leaseClientName(clientKindLease, "5f1c9a0b3e2d", "TestX/a b\n")
+	want := "go-test-redis:lease:5f1c9a0b3e2d:go-test-redis:TestX/a_b_"
+	if name != want {
+		t.Fatal(name)
+	}
+	if id := leaseIDFromClientName(name); id != "5f1c9a0b3e2d" {
+		t.Fatal(id)
+	}
+
+	testCases := []struct {
+		name string
+		id   string
+	}{
+		{"go-test-redis:control:abc:pkg:TestX", "abc"},
+		{"go-test-redis:wait", ""},
+		{"go-test-redis:pool", ""},
+		{"other:lease:abc", ""},
+		{"", ""},
+	}
+	for _, tc := range testCases {
+		if id := leaseIDFromClientName(tc.name); id != tc.id {
+			t.Errorf("leaseIDFromClientName(%q) = %q, want %q",
+				tc.name, id, tc.id)
+		}
+	}
+}
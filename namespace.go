@@ -0,0 +1,151 @@
+package go_test_redis
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// namespaceEnv is the name of environment variable with the namespace of
+// markers of databases.
+const namespaceEnv = "REDISTEST_NAMESPACE"
+
+// lockPrefix starts names of lock keys. Locks are shared by all
+// namespaces, so tests of different namespaces using the same databases
+// never lease one database at once.
+const lockPrefix = "redis-test-"
+
+// Notifications of released databases are shared by all namespaces, like
+// locks, so waiters are woken by databases released in any namespace.
+const (
+	releasedChannel = "redis-test-broadcast"
+	releasedStream  = "redis-test-released"
+)
+
+// namespace separates markers of databases of unrelated projects sharing
+// one redis server. Empty namespace uses names compatible with older
+// versions of this package: redis-test-kept-N, redis-test-dirty-N and
+// redis-test-leased-N markers and redis-test-owned set. Other namespaces
+// use names like redis-test:NS:kept-N. Lock keys (redis-test-N),
+// redis-test-broadcast channel and redis-test-released stream are the same
+// in all namespaces.
+type namespace string
+
+// WithNamespace sets namespace of markers of databases, like repository
+// name or CI job ID, so tests of unrelated projects sharing redis server do
+// not reclaim or repair each other's dirty databases. Locks of databases and
+// notifications of released ones are shared by all namespaces, so tests of
+// different namespaces never lease the same database at once and are woken
+// as soon as any database is released. It may be set with
+// REDISTEST_NAMESPACE environment variable. Namespace may contain letters,
+// digits and "._-/" characters.
+func WithNamespace(ns string) Option {
+	return func(o *testRedisOptions) {
+		o.dbs.namespace = namespace(ns)
+	}
+}
+
+func (ns namespace) validate() error {
+	for _, r := range ns {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("._-/", r):
+		default:
+			return fmt.Errorf("invalid character %q in namespace %q", r, ns)
+		}
+	}
+	return nil
+}
+
+func (ns namespace) prefix() string {
+	if ns == "" {
+		return "redis-test-"
+	}
+	return "redis-test:" + string(ns) + ":"
+}
+
+// lockKey returns the key of lock of database db. It is the same in all
+// namespaces.
+func (ns namespace) lockKey(db int) string {
+	return lockPrefix + strconv.Itoa(db)
+}
+
+func (ns namespace) keptKey(db int) string {
+	return ns.prefix() + "kept-" + strconv.Itoa(db)
+}
+
+// channel returns pub/sub channel of released databases. It is the same in
+// all namespaces.
+func (ns namespace) channel() string {
+	return releasedChannel
+}
+
+// dirtyKey returns the key of quarantine marker of dirty database db.
+func (ns namespace) dirtyKey(db int) string {
+	return ns.prefix() + "dirty-" + strconv.Itoa(db)
+}
+
+// leasedKey returns the key of marker of database db leased to test and not
+// cleaned yet.
+func (ns namespace) leasedKey(db int) string {
+	return ns.prefix() + "leased-" + strconv.Itoa(db)
+}
+
+// ownedKey returns the key of set of databases owned by tests. Database
+// becomes owned when it is leased to a test empty, so its data may be
+// flushed safely.
+func (ns namespace) ownedKey() string {
+	return ns.prefix() + "owned"
+}
+
+// releasedStream returns the key of stream of released databases. It is the
+// same in all namespaces.
+func (ns namespace) releasedStream() string {
+	return releasedStream
+}
+
+// lockKeyPattern returns SCAN pattern matching all lock keys.
+func (ns namespace) lockKeyPattern() string {
+	return lockPrefix + "*"
+}
+
+// parseLockKey returns database number from lock key.
+func (ns namespace) parseLockKey(key string) (int, bool) {
+	return parseDBKey(lockPrefix, key)
+}
+
+// parseDirtyKey returns database number from quarantine marker key of the
+// namespace.
+func (ns namespace) parseDirtyKey(key string) (int, bool) {
+	return parseDBKey(ns.prefix()+"dirty-", key)
+}
+
+// dirtyKeyPattern returns SCAN pattern matching all quarantine markers of
+// namespace.
+func (ns namespace) dirtyKeyPattern() string {
+	return ns.prefix() + "dirty-*"
+}
+
+// parseDBKey returns database number from key made of prefix and the
+// number.
+func parseDBKey(prefix, key string) (int, bool) {
+	if !strings.HasPrefix(key, prefix) {
+		return 0, false
+	}
+	s := key[len(prefix):]
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || strconv.Itoa(n) != s {
+		return 0, false
+	}
+	return n, true
+}
+
+// namespaceFromEnv returns namespace from environment variable.
+func namespaceFromEnv() (namespace, error) {
+	ns := namespace(os.Getenv(namespaceEnv))
+	if err := ns.validate(); err != nil {
+		return "", fmt.Errorf("invalid %v: %w", namespaceEnv, err)
+	}
+	return ns, nil
+}
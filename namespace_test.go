@@ -0,0 +1,203 @@
+package go_test_redis
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestNamespaceNames(t *testing.T) {
+	var legacy namespace
+	if k := legacy.lockKey(3); k != "redis-test-3" {
+		t.Fatal(k)
+	}
+	if k := legacy.keptKey(3); k != "redis-test-kept-3" {
+		t.Fatal(k)
+	}
+	if c := legacy.channel(); c != "redis-test-broadcast" {
+		t.Fatal(c)
+	}
+
+	ns := namespace("ci/job-1")
+	// locks are shared by all namespaces
+	if k := ns.lockKey(3); k != "redis-test-3" {
+		t.Fatal(k)
+	}
+	if k := ns.keptKey(3); k != "redis-test:ci/job-1:kept-3" {
+		t.Fatal(k)
+	}
+	// notifications are shared too
+	if c := ns.channel(); c != "redis-test-broadcast" {
+		t.Fatal(c)
+	}
+	if c := ns.releasedStream(); c != "redis-test-released" {
+		t.Fatal(c)
+	}
+}
+
+func TestNamespaceIsolation(t *testing.T) {
+	namespaces := []namespace{"", "a", "ab", "a-b", "a:b", "b"}
+	for _, ns := range namespaces {
+		for _, other := range namespaces {
+			if ns == other {
+				continue
+			}
+			if ns.lockKey(1) != other.lockKey(1) {
+				t.Errorf("namespaces %q and %q do not share locks",
+					ns, other)
+			}
+			if ns.channel() != other.channel() ||
+				ns.releasedStream() != other.releasedStream() {
+
+				t.Errorf("namespaces %q and %q do not share notifications",
+					ns, other)
+			}
+			markers := []string{
+				other.keptKey(1), other.channel(), other.releasedStream(),
+				other.dirtyKey(1), other.leasedKey(1), other.ownedKey(),
+			}
+			for _, key := range markers {
+				if db, ok := ns.parseLockKey(key); ok {
+					t.Errorf("key %q of namespace %q is parsed as lock "+
+						"of database %v", key, other, db)
+				}
+				if key == ns.keptKey(1) || key == ns.dirtyKey(1) ||
+					key == ns.leasedKey(1) || key == ns.ownedKey() {
+
+					t.Errorf("namespaces %q and %q share marker %q",
+						ns, other, key)
+				}
+			}
+		}
+		if ns.validate() == nil {
+			if db, ok := ns.parseLockKey(ns.lockKey(7)); !ok || db != 7 {
+				t.Errorf("can't parse lock key of namespace %q", ns)
+			}
+			// SCAN patterns use glob syntax similar to path.Match for
+			// keys without slashes
+			matched, err := path.Match(ns.lockKeyPattern(), ns.lockKey(7))
+			if err != nil || !matched {
+				t.Errorf("pattern of namespace %q does not match lock key",
+					ns)
+			}
+			if _, ok := ns.parseLockKey(ns.keptKey(7)); ok {
+				t.Errorf("kept key of namespace %q parsed as lock key", ns)
+			}
+			if db, ok := ns.parseDirtyKey(ns.dirtyKey(7)); !ok || db != 7 {
+				t.Errorf("can't parse dirty key of namespace %q", ns)
+			}
+			if _, ok := ns.parseDirtyKey(ns.lockKey(7)); ok {
+				t.Errorf("lock key of namespace %q parsed as dirty key", ns)
+			}
+		}
+	}
+}
+
+func TestNamespacesShareDatabases(t *testing.T) {
+	newTestServer(t)
+	ctx := context.Background()
+	cli := redis.NewClient(newRedisOpts(0))
+	defer closeOrFatal(t, cli)
+
+	dbsA := dbConfig{namespace: "a", allowed: []int{1, 2}}
+	dbsB := dbConfig{namespace: "b", allowed: []int{1, 2}}
+	lockerA := newServerLocker(cli, dbsA).(serverLocker)
+	lockerB := newServerLocker(cli, dbsB).(serverLocker)
+
+	dbA, _, err := lockerA.lockFreeDB(ctx, dbsA.allowed, "a", time.Minute,
+		nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// database of namespace a is still empty, but it is locked
+	dbB, _, err := lockerB.lockFreeDB(ctx, dbsB.allowed, "b", time.Minute,
+		nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbA < 0 || dbB < 0 || dbA == dbB {
+		t.Fatalf("namespaces leased databases %v and %v", dbA, dbB)
+	}
+	n, _, err := lockerB.lockFreeDB(ctx, dbsB.allowed, "b", time.Minute,
+		nil)
+	if err != nil || n != scriptAllLocked {
+		t.Fatal(n, err)
+	}
+	ok, err := lockerB.TryLock(ctx, dbA, "b", time.Minute)
+	if err != nil || ok {
+		t.Fatalf("database of other namespace is locked: %v, %v", ok, err)
+	}
+
+	// waiter of namespace a is woken by database released in namespace b
+	// at once, without waiting for rescan
+	chA, stopA, err := lockerA.Released(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = stopA() }()
+	if err = unlockDB(ctx, lockerB, dbB); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case n := <-chA:
+		if n != dbB {
+			t.Fatalf("namespace a is notified about database %v", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("release of other namespace is not notified")
+	}
+	ok, err = lockerA.TryLock(ctx, dbB, "a", time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("released database is not locked: %v, %v", ok, err)
+	}
+}
+
+func TestGetOrWaitFreeDBOtherNamespace(t *testing.T) {
+	newTestServer(t)
+	ctx := context.Background()
+	cli := redis.NewClient(newRedisOpts(0))
+	defer closeOrFatal(t, cli)
+	lockerA := newServerLocker(cli, dbConfig{namespace: "a"})
+	lockerB := newServerLocker(cli, dbConfig{namespace: "b"})
+	check := func(ctx context.Context, db int) (bool, error) {
+		return true, nil
+	}
+	for _, db := range []int{1, 2} {
+		if _, err := lockerB.TryLock(ctx, db, "b", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if err := unlockDB(ctx, lockerB, 2); err != nil {
+			t.Error(err)
+		}
+	}()
+	// rescan happens every 5 seconds, release must be noticed before
+	start := time.Now()
+	db := getOrWaitFreeDB(ctx, t, lockerA, []int{1, 2}, 10*time.Second, "a",
+		check, &DirtyPolicy{})
+	if db != 2 {
+		t.Fatal(db)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("release of other namespace is noticed in %v", d)
+	}
+}
+
+func TestNamespaceValidate(t *testing.T) {
+	for _, ns := range []namespace{"", "repo", "ci/job-1.2_x"} {
+		if err := ns.validate(); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, ns := range []namespace{"a:b", "a*", "a b", "a?", "[a]"} {
+		if err := ns.validate(); err == nil {
+			t.Errorf("expected error for namespace %q", ns)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package go_test_redis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const poolLeaseName = "go-test-redis pool"
+
+// Fixture loads initial data into the database cli is connected to.
+type Fixture func(ctx context.Context, cli *redis.Client) error
+
+// Pool maintains a set of spare databases that are already flushed and
+// optionally loaded with fixture. Spare databases are locked with usual
+// locks, so tests from other processes never pick them.
+//
+// Without fixture, tests using the pool are not waiting for cleanup of their
+// databases: the dirty database is swapped with the spare one using SWAPDB
+// and released immediately, the spare is flushed in background. With
+// fixture, new test database is swapped with the spare one loaded with
+// fixture, so test starts with fixture data instantly. In this case released
+// databases are flushed and unlocked in background.
+//
+// Pool should be created in TestMain and closed after all tests are done.
+type Pool struct {
+	cli     *redis.Client
+	locker  Locker
+	dbs     dbConfig
+	fixture Fixture
+	spares  chan int
+	jobs    chan poolJob
+	leased  map[int]struct{}
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	stop    chan struct{}
+	errs    []error
+}
+
+type poolJob struct {
+	db int
+	// release the database after flush instead of making it spare
+	release bool
+	// leasedKey is the leased marker of released database, it is deleted
+	// after flush
+	leasedKey string
+}
+
+// NewPool locks up to size free databases and prepares them in background.
+// Redis address is taken from REDISADDR environment variable. fixture may be
+// nil. Only options related to locking, like WithLocker and WithDatabases,
+// are used from opts; tests using the pool must be given the same ones.
+func NewPool(
+	ctx context.Context, size int, fixture Fixture, opts ...Option,
+) (*Pool, error) {
+	var op testRedisOptions
+	var err error
+	if op.dbs, err = dbConfigFromEnv(); err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(&op)
+	}
+
+	p := &Pool{
+		cli:     redis.NewClient(poolRedisOpts(op.dbs.control)),
+		locker:  op.locker,
+		dbs:     op.dbs,
+		fixture: fixture,
+		spares:  make(chan int, size),
+		// every leased database may be returned to the pool while spares
+		// are prepared
+		jobs:   make(chan poolJob, 1024),
+		leased: make(map[int]struct{}),
+		stop:   make(chan struct{}),
+	}
+	if err := checkTestServer(ctx, p.cli); err != nil {
+		_ = p.cli.Close()
+		return nil, err
+	}
+	if p.locker == nil {
+		p.locker = newServerLocker(p.cli, p.dbs)
+	}
+
+	value, err := encodeLeaseValue("", poolLeaseName)
+	if err != nil {
+		return nil, err
+	}
+	conn := p.cli.Conn(ctx)
+	defer conn.Close()
+	for i := 0; i < size; i++ {
+		db, err := lockSpareDB(ctx, p.locker, conn, p.dbs, -1, value)
+		if err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+		if db < 0 {
+			break
+		}
+		p.leased[db] = struct{}{}
+		if fixture == nil {
+			p.spares <- db
+		} else {
+			p.jobs <- poolJob{db: db}
+		}
+	}
+
+	p.wg.Add(2)
+	go p.worker()
+	go p.refreshLocks()
+	return p, nil
+}
+
+// WithPool makes WithRedis use spare databases from the pool.
+func WithPool(p *Pool) Option {
+	return func(o *testRedisOptions) {
+		o.pool = p
+	}
+}
+
+// Close waits for background jobs to finish, flushes and releases all
+// spare databases. Errors happened in background are returned too.
+func (p *Pool) Close() error {
+	close(p.stop)
+	p.wg.Wait()
+
+	ctx := context.Background()
+	conn := p.cli.Conn(ctx)
+	p.mu.Lock()
+	// release databases returned by tests and not flushed yet, spare
+	// databases are flushed below
+	for len(p.jobs) != 0 {
+		job := <-p.jobs
+		if !job.release {
+			continue
+		}
+		if err := p.prepare(ctx, job); err != nil {
+			p.errs = append(p.errs, err)
+		}
+	}
+	for db := range p.leased {
+		if err := flushDB(ctx, conn, p.dbs.control, db); err != nil {
+			p.errs = append(p.errs, err)
+			continue
+		}
+		if err := unlockDB(ctx, p.locker, db); err != nil {
+			p.errs = append(p.errs, err)
+		}
+	}
+	p.leased = nil
+	errs := p.errs
+	p.mu.Unlock()
+
+	if err := conn.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := p.cli.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) != 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// acquire loads fixture into freshly locked empty database db.
+func (p *Pool) acquire(ctx context.Context, t testing.TB, db int) {
+	if p.fixture == nil {
+		return
+	}
+
+	select {
+	case spare := <-p.spares:
+		conn := p.cli.Conn(ctx)
+		defer closeOrFatal(t, conn)
+		if err := conn.SwapDB(ctx, db, spare).Err(); err != nil {
+			t.Fatal(err)
+		}
+		// spare database is empty now, load fixture into it again
+		p.jobs <- poolJob{db: spare}
+	default:
+		// no spare database is ready, load fixture by ourselves
+		cli := redis.NewClient(poolRedisOpts(db))
+		defer closeOrFatal(t, cli)
+		if err := p.fixture(ctx, cli); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// release takes database db from test. The leased marker leasedKey is
+// deleted once the database is clean, before it is unlocked. Returns false
+// if pool can't do it and test should clean the database by itself.
+func (p *Pool) release(
+	ctx context.Context, t testing.TB, db int, leasedKey string,
+) bool {
+	conn := p.cli.Conn(ctx)
+	defer closeOrFatal(t, conn)
+
+	if p.fixture != nil {
+		// database stays locked until it is flushed in background
+		err := p.locker.Refresh(ctx, db, lockTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.jobs <- poolJob{db: db, release: true, leasedKey: leasedKey}
+		return true
+	}
+
+	select {
+	case spare := <-p.spares:
+		if err := conn.SwapDB(ctx, db, spare).Err(); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.Del(ctx, leasedKey).Err(); err != nil {
+			t.Fatal(err)
+		}
+		if err := unlockDB(ctx, p.locker, db); err != nil {
+			t.Fatal(err)
+		}
+		p.jobs <- poolJob{db: spare}
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Pool) worker() {
+	defer p.wg.Done()
+	ctx := context.Background()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case job := <-p.jobs:
+			if err := p.prepare(ctx, job); err != nil {
+				p.mu.Lock()
+				p.errs = append(p.errs, err)
+				p.mu.Unlock()
+			}
+		}
+	}
+}
+
+// prepare flushes database and either releases it or makes it spare.
+func (p *Pool) prepare(ctx context.Context, job poolJob) error {
+	conn := p.cli.Conn(ctx)
+	defer conn.Close()
+
+	if err := flushDB(ctx, conn, p.dbs.control, job.db); err != nil {
+		return err
+	}
+	if job.release {
+		// the marker lets dirty database be reclaimed if we die before
+		if err := conn.Del(ctx, job.leasedKey).Err(); err != nil {
+			return err
+		}
+		return unlockDB(ctx, p.locker, job.db)
+	}
+
+	if p.fixture != nil {
+		cli := redis.NewClient(poolRedisOpts(job.db))
+		err := p.fixture(ctx, cli)
+		if err2 := cli.Close(); err == nil {
+			err = err2
+		}
+		if err != nil {
+			return err
+		}
+	}
+	p.spares <- job.db
+	return nil
+}
+
+// refreshLocks prolongs locks of spare databases while pool is open.
+func (p *Pool) refreshLocks() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(lockTimeout / 4)
+	defer ticker.Stop()
+	ctx := context.Background()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		for db := range p.leased {
+			err := p.locker.Refresh(ctx, db, lockTimeout)
+			if err != nil {
+				p.errs = append(p.errs, err)
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+func poolRedisOpts(db int) *redis.Options {
+	return withClientName(newRedisOpts(db),
+		clientNamePrefix+":"+clientKindPool)
+}
+
+// flushDB flushes database db. Connection is left selected to control
+// database controlDB.
+func flushDB(
+	ctx context.Context, conn *redis.Conn, controlDB, db int,
+) error {
+	if err := conn.Select(ctx, db).Err(); err != nil {
+		return err
+	}
+	if err := conn.FlushDB(ctx).Err(); err != nil {
+		return err
+	}
+	return conn.Select(ctx, controlDB).Err()
+}
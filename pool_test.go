@@ -0,0 +1,182 @@
+package go_test_redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// waitFor waits until cond is true or fails the test.
+func waitFor(t testing.TB, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %v", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// isLocked reports if db is locked without changing the lock.
+func isLocked(t testing.TB, locker Locker, db int) bool {
+	locks, err := locker.Locks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range locks {
+		if l.DB == db {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPoolWithoutFixture(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+	p, err := NewPool(ctx, 2, nil, WithLocker(locker),
+		WithDatabases(1, 2, 3, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// spares are the first free databases
+	if len(p.spares) != 2 || !isLocked(t, locker, 1) ||
+		!isLocked(t, locker, 2) {
+
+		t.Fatalf("spares: %v", len(p.spares))
+	}
+
+	// database leased by test is swapped with spare and released
+	ok, err := locker.TryLock(ctx, 3, "test", time.Minute)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	s.DB(3).Set("a", "1")
+	leasedKey := dbConfig{}.namespace.leasedKey(3)
+	s.Set(leasedKey, "test")
+	if !p.release(ctx, t, 3, leasedKey) {
+		t.Fatal("database is not released to the pool")
+	}
+	if s.Exists(leasedKey) {
+		t.Fatal("leased marker of released database is not deleted")
+	}
+	if keys := s.DB(3).Keys(); len(keys) != 0 {
+		t.Fatalf("released database is not empty: %v", keys)
+	}
+	if isLocked(t, locker, 3) {
+		t.Fatal("released database is still locked")
+	}
+	// swapped out data is flushed in background and the spare is ready
+	// again
+	waitFor(t, "spare database", func() bool { return len(p.spares) == 2 })
+	for _, db := range []int{1, 2} {
+		if keys := s.DB(db).Keys(); len(keys) != 0 {
+			t.Fatalf("spare database %v is not flushed: %v", db, keys)
+		}
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, db := range []int{1, 2} {
+		if isLocked(t, locker, db) {
+			t.Fatalf("spare database %v is locked after Close", db)
+		}
+	}
+}
+
+func TestPoolWithFixture(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+	fixture := func(ctx context.Context, cli *redis.Client) error {
+		return cli.Set(ctx, "fixture", "1", 0).Err()
+	}
+	p, err := NewPool(ctx, 1, fixture, WithLocker(locker),
+		WithDatabases(1, 2, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "spare database", func() bool { return len(p.spares) == 1 })
+
+	// new test database gets fixture from the spare one
+	ok, err := locker.TryLock(ctx, 2, "test", time.Minute)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	p.acquire(ctx, t, 2)
+	if !s.DB(2).Exists("fixture") {
+		t.Fatal("fixture is not loaded into test database")
+	}
+	// the spare is loaded with fixture again in background
+	waitFor(t, "spare database", func() bool { return len(p.spares) == 1 })
+	if !s.DB(1).Exists("fixture") {
+		t.Fatal("fixture is not loaded into spare database")
+	}
+
+	// released database is flushed and unlocked in background
+	s.DB(2).Set("a", "1")
+	leasedKey := dbConfig{}.namespace.leasedKey(2)
+	s.Set(leasedKey, "test")
+	if !p.release(ctx, t, 2, leasedKey) {
+		t.Fatal("database is not released to the pool")
+	}
+	waitFor(t, "release of database", func() bool {
+		return !isLocked(t, locker, 2)
+	})
+	if s.Exists(leasedKey) {
+		t.Fatal("leased marker of released database is not deleted")
+	}
+	if keys := s.DB(2).Keys(); len(keys) != 0 {
+		t.Fatalf("released database is not flushed: %v", keys)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if isLocked(t, locker, 1) || len(s.DB(1).Keys()) != 0 {
+		t.Fatal("spare database is not flushed and released by Close")
+	}
+}
+
+func TestPoolCloseReleasesReturnedDatabases(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+	fixture := func(ctx context.Context, cli *redis.Client) error {
+		return nil
+	}
+	p, err := NewPool(ctx, 0, fixture, WithLocker(locker),
+		WithDatabases(1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// stop the worker, so the returned database stays in the queue
+	close(p.stop)
+	p.wg.Wait()
+	p.stop = make(chan struct{})
+
+	ok, err := locker.TryLock(ctx, 1, "test", time.Minute)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	s.DB(1).Set("a", "1")
+	leasedKey := dbConfig{}.namespace.leasedKey(1)
+	s.Set(leasedKey, "test")
+	p.release(ctx, t, 1, leasedKey)
+	// dirty database waiting for flush may be reclaimed by the marker
+	if !s.Exists(leasedKey) {
+		t.Fatal("leased marker is deleted before flush")
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if isLocked(t, locker, 1) || len(s.DB(1).Keys()) != 0 ||
+		s.Exists(leasedKey) {
+
+		t.Fatal("returned database is not flushed and released by Close")
+	}
+}
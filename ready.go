@@ -0,0 +1,220 @@
+package go_test_redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ReadyCheck is a predicate used by WaitForRedis to decide if redis is
+// ready for tests. It returns nil when redis is ready and an error describing
+// what we are still waiting for otherwise. Failed checks are retried until
+// they pass or the WaitForRedis timeout expires.
+type ReadyCheck func(ctx context.Context, cli *redis.Client) error
+
+// WithChecks adds readiness checks to WaitForRedis. CheckLoaded is always
+// performed first, checks from this option run after it in the given order.
+func WithChecks(checks ...ReadyCheck) WaitOption {
+	return func(o *waitOptions) {
+		o.checks = append(o.checks, checks...)
+	}
+}
+
+// CheckLoaded waits until redis finished loading dataset from disk or from
+// master (including async_loading on replicas).
+func CheckLoaded() ReadyCheck {
+	return func(ctx context.Context, cli *redis.Client) error {
+		info, err := infoSection(ctx, cli, "persistence")
+		if err != nil {
+			return err
+		}
+		msg := ""
+		if info["loading"] != "0" {
+			msg = "redis is loading dataset"
+		} else if v, ok := info["async_loading"]; ok && v != "0" {
+			msg = "redis is loading dataset asynchronously"
+		} else {
+			return nil
+		}
+		loadingInfo := make(map[string]string)
+		for k, v := range info {
+			if strings.HasPrefix(k, "loading") ||
+				strings.HasPrefix(k, "async_loading") {
+
+				loadingInfo[k] = v
+			}
+		}
+		return &notReadyError{msg: msg, info: loadingInfo}
+	}
+}
+
+// CheckPing waits for successful PING.
+func CheckPing() ReadyCheck {
+	return func(ctx context.Context, cli *redis.Client) error {
+		return cli.Ping(ctx).Err()
+	}
+}
+
+// CheckReplicaLink waits until replica is connected to its master
+// (master_link_status:up). Check passes immediately on master.
+func CheckReplicaLink() ReadyCheck {
+	return func(ctx context.Context, cli *redis.Client) error {
+		info, err := infoSection(ctx, cli, "replication")
+		if err != nil {
+			return err
+		}
+		if info["role"] != "slave" {
+			return nil
+		}
+		if st := info["master_link_status"]; st != "up" {
+			return fmt.Errorf("master link status is %v", st)
+		}
+		return nil
+	}
+}
+
+// CheckClusterState waits until CLUSTER INFO reports cluster_state:ok.
+func CheckClusterState() ReadyCheck {
+	return func(ctx context.Context, cli *redis.Client) error {
+		r, err := cli.ClusterInfo(ctx).Result()
+		if err != nil {
+			return err
+		}
+		if st := parseInfoResponse(r)["cluster_state"]; st != "ok" {
+			return fmt.Errorf("cluster state is %v", st)
+		}
+		return nil
+	}
+}
+
+// CheckMinVersion waits for redis server of version not less than minVersion.
+// Version is compared by numeric components, so "6.2" matches "6.2.0" and
+// newer versions.
+func CheckMinVersion(minVersion string) ReadyCheck {
+	return func(ctx context.Context, cli *redis.Client) error {
+		info, err := infoSection(ctx, cli, "server")
+		if err != nil {
+			return err
+		}
+		v := info["redis_version"]
+		cmp, err := compareVersions(v, minVersion)
+		if err != nil {
+			return err
+		}
+		if cmp < 0 {
+			return fmt.Errorf("redis version %v is less than required %v",
+				v, minVersion)
+		}
+		return nil
+	}
+}
+
+// CheckModules waits until all named modules appear in MODULE LIST.
+func CheckModules(names ...string) ReadyCheck {
+	return func(ctx context.Context, cli *redis.Client) error {
+		r, err := cli.Do(ctx, "MODULE", "LIST").Result()
+		if err != nil {
+			return err
+		}
+		loaded, err := parseModuleList(r)
+		if err != nil {
+			return err
+		}
+		var missing []string
+		for _, n := range names {
+			if _, ok := loaded[strings.ToLower(n)]; !ok {
+				missing = append(missing, n)
+			}
+		}
+		if len(missing) != 0 {
+			return fmt.Errorf("modules are not loaded: %v",
+				strings.Join(missing, ", "))
+		}
+		return nil
+	}
+}
+
+// CheckAOFRewrite waits until there is no AOF rewrite in progress or
+// scheduled.
+func CheckAOFRewrite() ReadyCheck {
+	return func(ctx context.Context, cli *redis.Client) error {
+		info, err := infoSection(ctx, cli, "persistence")
+		if err != nil {
+			return err
+		}
+		if info["aof_rewrite_in_progress"] != "0" ||
+			info["aof_rewrite_scheduled"] != "0" {
+
+			return errors.New("AOF rewrite is in progress")
+		}
+		return nil
+	}
+}
+
+func infoSection(
+	ctx context.Context, cli *redis.Client, section string,
+) (map[string]string, error) {
+	r, err := cli.Info(ctx, section).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseInfoResponse(r), nil
+}
+
+// parseModuleList returns set of lowercase module names from MODULE LIST
+// reply.
+func parseModuleList(r interface{}) (map[string]struct{}, error) {
+	modules, ok := r.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected MODULE LIST reply: %[1]T %[1]v", r)
+	}
+	result := make(map[string]struct{}, len(modules))
+	for _, m := range modules {
+		fields, ok := m.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf(
+				"unexpected MODULE LIST entry: %[1]T %[1]v", m)
+		}
+		for i := 0; i+1 < len(fields); i += 2 {
+			if k, _ := fields[i].(string); k != "name" {
+				continue
+			}
+			if name, ok := fields[i+1].(string); ok {
+				result[strings.ToLower(name)] = struct{}{}
+			}
+		}
+	}
+	return result, nil
+}
+
+// compareVersions compares dot separated numeric versions. Returns -1, 0 or 1
+// if a is less, equal or greater than b. Missing components are treated
+// as zeros.
+func compareVersions(a, b string) (int, error) {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var x, y int
+		var err error
+		if i < len(aParts) {
+			if x, err = strconv.Atoi(aParts[i]); err != nil {
+				return 0, fmt.Errorf("invalid version %q: %w", a, err)
+			}
+		}
+		if i < len(bParts) {
+			if y, err = strconv.Atoi(bParts[i]); err != nil {
+				return 0, fmt.Errorf("invalid version %q: %w", b, err)
+			}
+		}
+		if x < y {
+			return -1, nil
+		} else if x > y {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,66 @@
+package go_test_redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		want int
+	}{
+		{"6.0.8", "6.0.8", 0},
+		{"6.0.8", "6.0", 1},
+		{"6.2", "6.2.0", 0},
+		{"5.0.14", "6.0", -1},
+		{"7.0.0", "6.2.10", 1},
+		{"6.2.10", "6.2.9", 1},
+	}
+	for _, tc := range testCases {
+		got, err := compareVersions(tc.a, tc.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("compareVersions(%q, %q) = %v, want %v",
+				tc.a, tc.b, got, tc.want)
+		}
+	}
+
+	if _, err := compareVersions("6.x", "6.0"); err == nil {
+		t.Fatal("expected error on invalid version")
+	}
+}
+
+func TestParseModuleList(t *testing.T) {
+	in := []interface{}{
+		[]interface{}{"name", "search", "ver", int64(20006)},
+		[]interface{}{
+			"name", "ReJSON", "ver", int64(20007),
+			"path", "/opt/redis-stack/lib/rejson.so", "args", []interface{}{},
+		},
+	}
+	resp, err := parseModuleList(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp, map[string]struct{}{
+		"search": {},
+		"rejson": {},
+	}) {
+		t.Fatal(resp)
+	}
+
+	resp, err = parseModuleList([]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp) != 0 {
+		t.Fatal(resp)
+	}
+
+	if _, err = parseModuleList("OK"); err == nil {
+		t.Fatal("expected error on unexpected reply")
+	}
+}
@@ -0,0 +1,109 @@
+package go_test_redis
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// setEnv sets environment variable for the duration of the test.
+func setEnv(t testing.TB, key, value string) {
+	old, had := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if had {
+			_ = os.Setenv(key, old)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+// testServer is in-memory redis server for tests. Commands used by this
+// package and not supported by miniredis are emulated: CONFIG GET
+// databases, CLIENT ID and CLIENT LIST.
+type testServer struct {
+	*miniredis.Miniredis
+	mu      sync.Mutex
+	nextID  int64
+	clients map[*server.Peer]*ClientInfo
+}
+
+// newTestServer starts test server marked as a test one and points
+// REDISADDR to it.
+func newTestServer(t testing.TB) *testServer {
+	s := &testServer{
+		Miniredis: miniredis.RunT(t),
+		clients:   make(map[*server.Peer]*ClientInfo),
+	}
+	s.Server().SetPreHook(s.hook)
+	if err := s.Set(testServerKey, "test"); err != nil {
+		t.Fatal(err)
+	}
+	setEnv(t, "REDISADDR", s.Addr())
+	return s
+}
+
+func (s *testServer) hook(c *server.Peer, cmd string, args ...string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, ok := s.clients[c]
+	if !ok {
+		s.nextID++
+		client = &ClientInfo{
+			ID:   s.nextID,
+			Addr: "127.0.0.1:" + strconv.FormatInt(40000+s.nextID, 10),
+		}
+		s.clients[c] = client
+		c.OnDisconnect(func() {
+			s.mu.Lock()
+			delete(s.clients, c)
+			s.mu.Unlock()
+		})
+	}
+	client.Name = c.ClientName
+	client.Cmd = strings.ToLower(cmd)
+	sub := ""
+	if len(args) != 0 {
+		sub = strings.ToUpper(args[0])
+	}
+
+	switch {
+	case cmd == "SELECT" && len(args) == 1:
+		// let miniredis validate and select the database
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			client.DB = n
+		}
+	case cmd == "CONFIG" && sub == "GET" && len(args) == 2 &&
+		args[1] == "databases":
+
+		c.WriteLen(2)
+		c.WriteBulk("databases")
+		c.WriteBulk("16")
+		return true
+	case cmd == "CLIENT" && sub == "ID":
+		c.WriteInt(int(client.ID))
+		return true
+	case cmd == "CLIENT" && sub == "LIST":
+		lines := make([]string, 0, len(s.clients))
+		for _, cl := range s.clients {
+			lines = append(lines, fmt.Sprintf(
+				"id=%v addr=%v name=%v age=0 idle=0 db=%v sub=0 psub=0 "+
+					"cmd=%v", cl.ID, cl.Addr, cl.Name, cl.DB, cl.Cmd))
+		}
+		sort.Strings(lines)
+		c.WriteBulk(strings.Join(lines, "\n") + "\n")
+		return true
+	}
+	return false
+}
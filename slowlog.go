@@ -0,0 +1,199 @@
+package go_test_redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// slowlogFetchLen is the maximum number of slow log entries read at cleanup.
+// Server keeps only slowlog-max-len latest entries anyway.
+const slowlogFetchLen = 1024
+
+// WithSlowlog logs slow commands issued by connections of the returned
+// client (and of clients created from its options) while the test was
+// running, so accidentally O(N) commands like KEYS in code under test are
+// noticed. Commands are taken from SLOWLOG of the server, so only commands
+// slower than slowlog-log-slower-than server setting are reported. Latency
+// spikes registered by LATENCY monitor of the server during the test are
+// logged too, they are not attributed to clients and may be caused by other
+// tests.
+func WithSlowlog() Option {
+	return func(o *testRedisOptions) {
+		o.slowlog = true
+	}
+}
+
+// slowlogEntry is one entry of SLOWLOG GET output.
+type slowlogEntry struct {
+	ID         int64
+	Time       time.Time
+	Duration   time.Duration
+	Args       []string
+	ClientAddr string
+	ClientName string
+}
+
+// latencyEvent is one event of LATENCY LATEST output.
+type latencyEvent struct {
+	Name   string
+	Time   time.Time
+	Latest time.Duration
+	Max    time.Duration
+}
+
+// slowlogMark is the state of slow log and latency monitor at the start of
+// the lease.
+type slowlogMark struct {
+	lastID int64
+	start  time.Time
+}
+
+// markSlowlog remembers the last slow log entry, so only entries made
+// during the test are reported.
+func markSlowlog(
+	ctx context.Context, cli *redis.Client,
+) (slowlogMark, error) {
+	m := slowlogMark{lastID: -1, start: time.Now()}
+	r, err := cli.Do(ctx, "slowlog", "get", 1).Result()
+	if err != nil {
+		return m, err
+	}
+	entries, err := parseSlowlog(r)
+	if err != nil {
+		return m, err
+	}
+	if len(entries) != 0 {
+		m.lastID = entries[0].ID
+	}
+	return m, nil
+}
+
+// reportSlowlog logs slow commands of connections named clientName made
+// after mark and latency events happened after mark. Commands may be
+// disabled or renamed on managed servers, the error is returned then.
+func reportSlowlog(
+	ctx context.Context, t testing.TB, cli *redis.Client, mark slowlogMark,
+	clientName string,
+) error {
+	r, err := cli.Do(ctx, "slowlog", "get", slowlogFetchLen).Result()
+	if err != nil {
+		return err
+	}
+	entries, err := parseSlowlog(r)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	// entries are ordered from the newest one
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.ID > mark.lastID && e.ClientName == clientName {
+			lines = append(lines, describeSlowlogEntry(e))
+		}
+	}
+	if len(lines) != 0 {
+		t.Logf("%v slow redis commands:\n%v",
+			len(lines), strings.Join(lines, "\n"))
+	}
+
+	r, err = cli.Do(ctx, "latency", "latest").Result()
+	if err != nil {
+		return err
+	}
+	events, err := parseLatencyLatest(r)
+	if err != nil {
+		return err
+	}
+	lines = lines[:0]
+	// LATENCY LATEST has seconds resolution
+	since := mark.start.Truncate(time.Second)
+	for _, e := range events {
+		if !e.Time.Before(since) {
+			lines = append(lines, fmt.Sprintf(
+				"event=%v time=%v latest=%v max=%v", e.Name,
+				e.Time.Format(time.RFC3339), e.Latest, e.Max))
+		}
+	}
+	if len(lines) != 0 {
+		t.Logf("redis latency events during the test:\n%v",
+			strings.Join(lines, "\n"))
+	}
+	return nil
+}
+
+func describeSlowlogEntry(e slowlogEntry) string {
+	return fmt.Sprintf("id=%v time=%v duration=%v addr=%v cmd=%v",
+		e.ID, e.Time.Format(time.RFC3339), e.Duration, e.ClientAddr,
+		strings.Join(e.Args, " "))
+}
+
+// parseSlowlog parses SLOWLOG GET reply. Client address and name are
+// reported by redis 4.0 and newer.
+func parseSlowlog(r interface{}) ([]slowlogEntry, error) {
+	items, ok := r.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected slowlog reply: %v", r)
+	}
+	entries := make([]slowlogEntry, 0, len(items))
+	for _, item := range items {
+		fields, ok := item.([]interface{})
+		if !ok || len(fields) < 4 {
+			return nil, fmt.Errorf("unexpected slowlog entry: %v", item)
+		}
+		var e slowlogEntry
+		id, ok1 := fields[0].(int64)
+		ts, ok2 := fields[1].(int64)
+		us, ok3 := fields[2].(int64)
+		args, ok4 := fields[3].([]interface{})
+		if !ok1 || !ok2 || !ok3 || !ok4 {
+			return nil, fmt.Errorf("unexpected slowlog entry: %v", item)
+		}
+		e.ID = id
+		e.Time = time.Unix(ts, 0)
+		e.Duration = time.Duration(us) * time.Microsecond
+		e.Args = make([]string, len(args))
+		for i, a := range args {
+			e.Args[i] = fmt.Sprint(a)
+		}
+		if len(fields) >= 6 {
+			e.ClientAddr, _ = fields[4].(string)
+			e.ClientName, _ = fields[5].(string)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseLatencyLatest parses LATENCY LATEST reply.
+func parseLatencyLatest(r interface{}) ([]latencyEvent, error) {
+	items, ok := r.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected latency reply: %v", r)
+	}
+	events := make([]latencyEvent, 0, len(items))
+	for _, item := range items {
+		fields, ok := item.([]interface{})
+		if !ok || len(fields) < 4 {
+			return nil, fmt.Errorf("unexpected latency event: %v", item)
+		}
+		name, ok1 := fields[0].(string)
+		ts, ok2 := fields[1].(int64)
+		latest, ok3 := fields[2].(int64)
+		max, ok4 := fields[3].(int64)
+		if !ok1 || !ok2 || !ok3 || !ok4 {
+			return nil, fmt.Errorf("unexpected latency event: %v", item)
+		}
+		events = append(events, latencyEvent{
+			Name:   name,
+			Time:   time.Unix(ts, 0),
+			Latest: time.Duration(latest) * time.Millisecond,
+			Max:    time.Duration(max) * time.Millisecond,
+		})
+	}
+	return events, nil
+}
@@ -0,0 +1,89 @@
+package go_test_redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestParseSlowlog(t *testing.T) {
+	r := []interface{}{
+		[]interface{}{int64(14), int64(1600000000), int64(15000),
+			[]interface{}{"KEYS", "*"}, "127.0.0.1:5000",
+			"go-test-redis:lease:abc:pkg:TestX"},
+		// redis before 4.0 does not report clients
+		[]interface{}{int64(13), int64(1600000000), int64(20),
+			[]interface{}{"GET", "a"}},
+	}
+	entries, err := parseSlowlog(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatal(entries)
+	}
+	e := entries[0]
+	if e.ID != 14 || e.Duration != 15*time.Millisecond ||
+		e.ClientName != "go-test-redis:lease:abc:pkg:TestX" ||
+		len(e.Args) != 2 || e.Args[0] != "KEYS" {
+
+		t.Fatalf("%+v", e)
+	}
+	if entries[1].ClientName != "" || entries[1].ID != 13 {
+		t.Fatalf("%+v", entries[1])
+	}
+
+	if _, err := parseSlowlog([]interface{}{"x"}); err == nil {
+		t.Fatal("error expected")
+	}
+}
+
+func TestParseLatencyLatest(t *testing.T) {
+	r := []interface{}{
+		[]interface{}{"command", int64(1600000000), int64(250), int64(1000)},
+	}
+	events, err := parseLatencyLatest(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Name != "command" ||
+		events[0].Latest != 250*time.Millisecond ||
+		events[0].Max != time.Second ||
+		!events[0].Time.Equal(time.Unix(1600000000, 0)) {
+
+		t.Fatalf("%+v", events)
+	}
+}
+
+func TestSlowlogUnsupported(t *testing.T) {
+	// test server does not support SLOWLOG, like managed servers with
+	// renamed commands
+	newTestServer(t)
+	rec := &errorsRecorder{TB: t}
+	var db int
+	t.Run("lease", func(t *testing.T) {
+		rec.TB = t
+		cli := WithRedis(rec, WithSlowlog())
+		db = cli.Options().DB
+	})
+	if len(rec.errs) != 1 ||
+		!strings.HasPrefix(rec.errs[0], "can't mark slow redis commands") {
+
+		t.Fatal(rec.errs)
+	}
+
+	ctx := context.Background()
+	ctl := redis.NewClient(newRedisOpts(0))
+	defer closeOrFatal(t, ctl)
+	n, err := ctl.Exists(ctx, dbConfig{}.namespace.lockKey(db)).Result()
+	if err != nil || n != 0 {
+		t.Fatalf("database %v is not unlocked: %v, %v", db, n, err)
+	}
+	err = reportSlowlog(ctx, t, ctl, slowlogMark{}, "")
+	if err == nil {
+		t.Fatal("error of SLOWLOG is not returned")
+	}
+}
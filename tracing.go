@@ -0,0 +1,89 @@
+package go_test_redis
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+)
+
+// tracerName is the instrumentation name of spans made by this package.
+const tracerName = "github.com/olomix/go-test-redis"
+
+// WithTracerProvider sets OpenTelemetry tracer provider used to trace
+// leases: waiting for free database, its acquisition and cleanup, and every
+// command of the returned client. Global tracer provider is used by
+// default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *testRedisOptions) {
+		o.tracerProvider = tp
+	}
+}
+
+// tracingHook makes span for every command of the leased client. Spans of
+// commands called with context without span are children of the lease
+// span.
+type tracingHook struct {
+	tracer trace.Tracer
+	lease  trace.Span
+}
+
+func (h tracingHook) start(
+	ctx context.Context, name string, attrs ...label.KeyValue,
+) context.Context {
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		ctx = trace.ContextWithSpan(ctx, h.lease)
+	}
+	ctx, _ = h.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs, label.String("db.system", "redis"))...))
+	return ctx
+}
+
+func (h tracingHook) end(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	if err != nil && err != redis.Nil {
+		span.RecordError(ctx, err, trace.WithErrorStatus(codes.Error))
+	}
+	span.End()
+}
+
+func (h tracingHook) BeforeProcess(
+	ctx context.Context, cmd redis.Cmder,
+) (context.Context, error) {
+	return h.start(ctx, "redis "+cmd.Name(),
+		label.String("db.operation", cmd.Name())), nil
+}
+
+func (h tracingHook) AfterProcess(
+	ctx context.Context, cmd redis.Cmder,
+) error {
+	h.end(ctx, cmd.Err())
+	return nil
+}
+
+func (h tracingHook) BeforeProcessPipeline(
+	ctx context.Context, cmds []redis.Cmder,
+) (context.Context, error) {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+	}
+	return h.start(ctx, "redis pipeline",
+		label.Array("db.operations", names)), nil
+}
+
+func (h tracingHook) AfterProcessPipeline(
+	ctx context.Context, cmds []redis.Cmder,
+) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && cmdErr != redis.Nil {
+			err = cmdErr
+			break
+		}
+	}
+	h.end(ctx, err)
+	return nil
+}
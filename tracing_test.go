@@ -0,0 +1,61 @@
+package go_test_redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/api/trace/tracetest"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestTracingHook(t *testing.T) {
+	var recorder tracetest.StandardSpanRecorder
+	tracer := tracetest.NewTracerProvider(
+		tracetest.WithSpanRecorder(&recorder)).Tracer(tracerName)
+	_, lease := tracer.Start(context.Background(), "redis-test.lease")
+	h := tracingHook{tracer: tracer, lease: lease}
+
+	ctx := context.Background()
+	get := redis.NewStringCmd(ctx, "get", "a")
+	get.SetErr(redis.Nil)
+	cmdCtx, _ := h.BeforeProcess(ctx, get)
+	_ = h.AfterProcess(cmdCtx, get)
+
+	set := redis.NewStatusCmd(ctx, "set", "a", "b")
+	set.SetErr(errors.New("ERR oops"))
+	cmds := []redis.Cmder{redis.NewIntCmd(ctx, "incr", "b"), set}
+	cmdCtx, _ = h.BeforeProcessPipeline(ctx, cmds)
+	_ = h.AfterProcessPipeline(cmdCtx, cmds)
+	lease.End()
+
+	spans := recorder.Completed()
+	if len(spans) != 3 {
+		t.Fatalf("want 3 spans, got %v", len(spans))
+	}
+	getSpan, pipeSpan, leaseSpan := spans[0], spans[1], spans[2]
+
+	if getSpan.Name() != "redis get" || getSpan.StatusCode() != codes.Unset {
+		t.Fatalf("%v: %v", getSpan.Name(), getSpan.StatusCode())
+	}
+	if pipeSpan.Name() != "redis pipeline" ||
+		pipeSpan.StatusCode() != codes.Error ||
+		len(pipeSpan.Events()) != 1 {
+
+		t.Fatalf("%v: %v, %v", pipeSpan.Name(), pipeSpan.StatusCode(),
+			pipeSpan.Events())
+	}
+	lc := leaseSpan.SpanContext()
+	for _, s := range []*tracetest.Span{getSpan, pipeSpan} {
+		// commands called without span are children of the lease
+		if s.SpanContext().TraceID != lc.TraceID ||
+			s.ParentSpanID() != lc.SpanID {
+
+			t.Fatalf("%v is not a child of the lease", s.Name())
+		}
+	}
+	if leaseSpan.ParentSpanID().IsValid() {
+		t.Fatal("lease span has parent")
+	}
+}
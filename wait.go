@@ -2,57 +2,190 @@ package go_test_redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
 type waitOptions struct {
-	timeout time.Duration
+	timeout  time.Duration
+	checks   []ReadyCheck
+	progress func(a WaitAttempt)
+	addrs    []string
 }
 
-type waitOptionFn func(o *waitOptions)
+// WaitOption configures WaitForRedis.
+type WaitOption func(o *waitOptions)
 
 // WithTimeout overwrite default timeout to wait for redis availability in
 // WaitForRedis function
-func WithTimeout(timeout time.Duration) waitOptionFn {
+func WithTimeout(timeout time.Duration) WaitOption {
 	return func(o *waitOptions) {
 		o.timeout = timeout
 	}
 }
 
+// WithAddrs makes WaitForRedis wait for all listed redis endpoints instead
+// of the one from REDISADDR environment variable. Each address may be in
+// host:port form or redis:// URL. Endpoints are waited for in parallel under
+// the same timeout. If some of them did not become ready, *MultiWaitError
+// is returned, even for a single address. Progress callback may be called
+// concurrently in this case.
+func WithAddrs(addrs ...string) WaitOption {
+	return func(o *waitOptions) {
+		o.addrs = append(o.addrs, addrs...)
+	}
+}
+
 // WaitForRedis is useful to use in TestMain function to wait until
 // redis would be available. It may be used if redis is not running
 // all the time and is starting in parallel with tests. Default timeout to
 // wait for redis is 5 seconds. It may be overwritten using WithTimeout option.
-func WaitForRedis(ops ...waitOptionFn) error {
-	var options = waitOptions{timeout: 5 * time.Second}
+// By default we wait until redis finished loading dataset, more readiness
+// checks may be added with WithChecks option. On timeout *WaitError is
+// returned with all attempts made.
+func WaitForRedis(ops ...WaitOption) error {
+	var options = waitOptions{
+		timeout: 5 * time.Second,
+		checks:  []ReadyCheck{CheckLoaded()},
+	}
 	for _, fn := range ops {
 		fn(&options)
 	}
 
-	redisAddr := os.Getenv("REDISADDR")
-	if redisAddr == "" {
-		redisAddr = ":6379"
+	endpoints, err := waitEndpoints(options.addrs)
+	if err != nil {
+		return err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), options.timeout)
 	defer cancel()
 
-	err := waitForSocket(ctx, redisAddr)
+	if len(options.addrs) == 0 {
+		return waitEndpoint(ctx, endpoints[0], &options)
+	}
+
+	errs := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i := range endpoints {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = waitEndpoint(ctx, endpoints[i], &options)
+		}(i)
+	}
+	wg.Wait()
+
+	var multiErr MultiWaitError
+	for _, err := range errs {
+		if err != nil {
+			multiErr.Errors = append(multiErr.Errors, err)
+		}
+	}
+	if len(multiErr.Errors) != 0 {
+		return &multiErr
+	}
+	return nil
+}
+
+// MultiWaitError is returned from WaitForRedis if any of endpoints
+// passed with WithAddrs option did not become ready. errors.Is and errors.As
+// match errors of all failed endpoints, so errors.Is(err,
+// context.DeadlineExceeded) works as for a single endpoint.
+type MultiWaitError struct {
+	// Errors contains one error per failed endpoint, usually *WaitError.
+	Errors []error
+}
+
+// Is reports if error of some endpoint matches target.
+func (e *MultiWaitError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error of endpoints that matches target.
+func (e *MultiWaitError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *MultiWaitError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%v of redis endpoints are not ready: %v",
+		len(e.Errors), strings.Join(msgs, "; "))
+}
+
+type redisEndpoint struct {
+	addr string
+	opts *redis.Options
+}
+
+// waitEndpoints returns list of endpoints to wait for. If addrs is empty,
+// the only endpoint is from REDISADDR environment variable.
+func waitEndpoints(addrs []string) ([]redisEndpoint, error) {
+	if len(addrs) == 0 {
+		redisAddr := os.Getenv("REDISADDR")
+		if redisAddr == "" {
+			redisAddr = ":6379"
+		}
+		return []redisEndpoint{{addr: redisAddr, opts: newRedisOpts(0)}}, nil
+	}
+
+	endpoints := make([]redisEndpoint, 0, len(addrs))
+	for _, addr := range addrs {
+		if !strings.Contains(addr, "://") {
+			endpoints = append(endpoints, redisEndpoint{
+				addr: addr,
+				opts: &redis.Options{Addr: addr},
+			})
+			continue
+		}
+		opts, err := redis.ParseURL(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis URL: %w", err)
+		}
+		endpoints = append(endpoints, redisEndpoint{addr: opts.Addr, opts: opts})
+	}
+	return endpoints, nil
+}
+
+func waitEndpoint(
+	ctx context.Context, ep redisEndpoint, options *waitOptions,
+) error {
+	rec := newWaitRecorder(ep.addr, options.progress)
+	err := waitForSocket(ctx, rec)
 	if err != nil {
 		return err
 	}
 
-	return waitRedisLoaded(ctx)
+	return waitRedisReady(ctx, rec, ep.opts, options.checks)
 }
 
-func waitRedisLoaded(ctx context.Context) (err error) {
-	cli := redis.NewClient(newRedisOpts(0))
+func waitRedisReady(
+	ctx context.Context, rec *waitRecorder, opts *redis.Options,
+	checks []ReadyCheck,
+) (err error) {
+	defer rec.phaseDone(WaitPhaseReady, time.Now())
+
+	cli := redis.NewClient(withClientName(opts,
+		clientNamePrefix+":"+clientKindWait))
 	defer func() {
 		err2 := cli.Close()
 		if err2 != nil && err == nil {
@@ -66,16 +199,18 @@ func waitRedisLoaded(ctx context.Context) (err error) {
 	for {
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("wait for redis loading failed: %w", ctx.Err())
+			return rec.fail(WaitPhaseReady, ctx.Err())
 		default:
 		}
 
-		r, err := cli.Info(ctx, "persistence").Result()
-		if err != nil {
-			return err
+		attemptStart := time.Now()
+		checkErr := runChecks(ctx, cli, checks)
+		if checkErr != nil && ctx.Err() != nil {
+			// attempt was interrupted by timeout, keep previous one as last
+			return rec.fail(WaitPhaseReady, ctx.Err())
 		}
-
-		if loading := parseInfoResponse(r)["loading"]; loading == "0" {
+		rec.attempt(WaitPhaseReady, attemptStart, checkErr)
+		if checkErr == nil {
 			return nil
 		}
 
@@ -87,6 +222,18 @@ func waitRedisLoaded(ctx context.Context) (err error) {
 	}
 }
 
+// runChecks returns the error of the first failed check.
+func runChecks(
+	ctx context.Context, cli *redis.Client, checks []ReadyCheck,
+) error {
+	for _, check := range checks {
+		if err := check(ctx, cli); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func parseInfoResponse(in string) map[string]string {
 	lines := strings.Split(in, "\n")
 	result := make(map[string]string, len(lines))
@@ -104,7 +251,9 @@ func parseInfoResponse(in string) map[string]string {
 	return result
 }
 
-func waitForSocket(ctx context.Context, addr string) error {
+func waitForSocket(ctx context.Context, rec *waitRecorder) error {
+	defer rec.phaseDone(WaitPhaseDial, time.Now())
+
 	var (
 		err   error
 		conn  net.Conn
@@ -115,11 +264,16 @@ func waitForSocket(ctx context.Context, addr string) error {
 	for {
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("wait for %v failed: %w", addr, err)
+			return rec.fail(WaitPhaseDial, ctx.Err())
 		default:
 		}
 
-		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		attemptStart := time.Now()
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", rec.addr)
+		if err != nil && ctx.Err() != nil {
+			return rec.fail(WaitPhaseDial, ctx.Err())
+		}
+		rec.attempt(WaitPhaseDial, attemptStart, err)
 		if err != nil {
 			time.Sleep(tmMin)
 			tmMin *= 2
@@ -0,0 +1,182 @@
+package go_test_redis
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Phases of WaitForRedis reported in WaitAttempt and WaitError.
+const (
+	// WaitPhaseDial is waiting for redis to accept TCP connections.
+	WaitPhaseDial = "dial"
+	// WaitPhaseReady is waiting for readiness checks to pass.
+	WaitPhaseReady = "ready"
+)
+
+// WaitAttempt describes one attempt of WaitForRedis to reach redis.
+type WaitAttempt struct {
+	Addr  string
+	Phase string
+	// Time when attempt was started.
+	Time time.Time
+	// Elapsed is time passed from WaitForRedis start to the end of attempt.
+	Elapsed time.Duration
+	// Err is nil if attempt was successful.
+	Err error
+	// Info contains INFO fields that were relevant for the failed check,
+	// like loading_loaded_perc when redis is loading dataset.
+	Info map[string]string
+}
+
+func (a WaitAttempt) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v %v attempt at %v", a.Addr, a.Phase,
+		a.Elapsed.Round(time.Millisecond))
+	if a.Err == nil {
+		b.WriteString(": ok")
+		return b.String()
+	}
+	fmt.Fprintf(&b, ": %v", a.Err)
+	if len(a.Info) != 0 {
+		keys := make([]string, 0, len(a.Info))
+		for k := range a.Info {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, " %v=%v", k, a.Info[k])
+		}
+	}
+	return b.String()
+}
+
+// WaitError is returned from WaitForRedis when redis did not become ready
+// in time. It records every attempt made, so it is possible to tell if
+// nothing was listening on the address, authentication failed or redis was
+// still loading dataset.
+type WaitError struct {
+	Addr string
+	// Phase we were stuck in when timeout expired.
+	Phase string
+	// Elapsed is time spent in each phase.
+	Elapsed  map[string]time.Duration
+	Attempts []WaitAttempt
+	// Err is the reason of failure, usually context.DeadlineExceeded.
+	Err error
+}
+
+func (e *WaitError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "wait for %v failed in %v phase", e.Addr, e.Phase)
+	for _, phase := range []string{WaitPhaseDial, WaitPhaseReady} {
+		if d, ok := e.Elapsed[phase]; ok {
+			fmt.Fprintf(&b, ", %v %v", phase, d.Round(time.Millisecond))
+		}
+	}
+	fmt.Fprintf(&b, ", %v attempts", len(e.Attempts))
+	if last := e.LastAttempt(); last != nil && last.Err != nil {
+		fmt.Fprintf(&b, ", last error: %v", last.Err)
+		for _, k := range []string{
+			"loading_loaded_perc", "loading_eta_seconds",
+		} {
+			if v, ok := last.Info[k]; ok {
+				fmt.Fprintf(&b, " %v=%v", k, v)
+			}
+		}
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+	return b.String()
+}
+
+func (e *WaitError) Unwrap() error {
+	return e.Err
+}
+
+// LastAttempt returns the last attempt or nil if there were no attempts.
+func (e *WaitError) LastAttempt() *WaitAttempt {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return &e.Attempts[len(e.Attempts)-1]
+}
+
+// WithProgress sets a callback that is called after every attempt
+// of WaitForRedis to reach redis.
+func WithProgress(fn func(a WaitAttempt)) WaitOption {
+	return func(o *waitOptions) {
+		o.progress = fn
+	}
+}
+
+// WithLogf logs every attempt of WaitForRedis using logf function,
+// t.Logf or log.Printf for example.
+func WithLogf(logf func(format string, args ...interface{})) WaitOption {
+	return WithProgress(func(a WaitAttempt) {
+		logf("%v", a)
+	})
+}
+
+// notReadyError is returned by readiness checks to attach INFO fields to
+// the error.
+type notReadyError struct {
+	msg  string
+	info map[string]string
+}
+
+func (e *notReadyError) Error() string {
+	return e.msg
+}
+
+// waitRecorder collects attempts of one WaitForRedis call.
+type waitRecorder struct {
+	addr     string
+	start    time.Time
+	progress func(a WaitAttempt)
+	attempts []WaitAttempt
+	elapsed  map[string]time.Duration
+}
+
+func newWaitRecorder(addr string, progress func(a WaitAttempt)) *waitRecorder {
+	return &waitRecorder{
+		addr:     addr,
+		start:    time.Now(),
+		progress: progress,
+		elapsed:  make(map[string]time.Duration),
+	}
+}
+
+func (r *waitRecorder) attempt(phase string, start time.Time, err error) {
+	a := WaitAttempt{
+		Addr:    r.addr,
+		Phase:   phase,
+		Time:    start,
+		Elapsed: time.Since(r.start),
+		Err:     err,
+	}
+	var nrErr *notReadyError
+	if errors.As(err, &nrErr) {
+		a.Info = nrErr.info
+	}
+	r.attempts = append(r.attempts, a)
+	if r.progress != nil {
+		r.progress(a)
+	}
+}
+
+// phaseDone records time spent in phase started at phaseStart.
+func (r *waitRecorder) phaseDone(phase string, phaseStart time.Time) {
+	r.elapsed[phase] = time.Since(phaseStart)
+}
+
+func (r *waitRecorder) fail(phase string, err error) *WaitError {
+	return &WaitError{
+		Addr:     r.addr,
+		Phase:    phase,
+		Elapsed:  r.elapsed,
+		Attempts: r.attempts,
+		Err:      err,
+	}
+}
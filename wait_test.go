@@ -1,10 +1,147 @@
 package go_test_redis
 
 import (
+	"context"
+	"errors"
+	"net"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
+func TestWaitForRedisNothingListening(t *testing.T) {
+	addr := closedAddr(t)
+
+	oldAddr, hadAddr := os.LookupEnv("REDISADDR")
+	if err := os.Setenv("REDISADDR", addr); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if hadAddr {
+			_ = os.Setenv("REDISADDR", oldAddr)
+		} else {
+			_ = os.Unsetenv("REDISADDR")
+		}
+	}()
+
+	var progress []WaitAttempt
+	err := WaitForRedis(
+		WithTimeout(300*time.Millisecond),
+		WithProgress(func(a WaitAttempt) { progress = append(progress, a) }),
+	)
+	var waitErr *WaitError
+	if !errors.As(err, &waitErr) {
+		t.Fatalf("expected *WaitError, got %[1]T %[1]v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded error, got %v", err)
+	}
+	if waitErr.Phase != WaitPhaseDial || waitErr.Addr != addr {
+		t.Fatal(waitErr)
+	}
+	if len(waitErr.Attempts) == 0 ||
+		len(waitErr.Attempts) != len(progress) {
+
+		t.Fatalf("attempts: %v, progress: %v",
+			len(waitErr.Attempts), len(progress))
+	}
+	if waitErr.LastAttempt().Err == nil {
+		t.Fatal("expected dial error in last attempt")
+	}
+	if !strings.Contains(err.Error(), "dial") {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForRedisMultipleAddrs(t *testing.T) {
+	addr1 := closedAddr(t)
+	addr2 := closedAddr(t)
+	err := WaitForRedis(
+		WithTimeout(300*time.Millisecond),
+		WithAddrs(addr1, "redis://:secret@"+addr2+"/3"),
+	)
+	var multiErr *MultiWaitError
+	if !errors.As(err, &multiErr) {
+		t.Fatalf("expected *MultiWaitError, got %[1]T %[1]v", err)
+	}
+	if len(multiErr.Errors) != 2 {
+		t.Fatal(multiErr)
+	}
+	for i, addr := range []string{addr1, addr2} {
+		var waitErr *WaitError
+		if !errors.As(multiErr.Errors[i], &waitErr) {
+			t.Fatalf("expected *WaitError, got %[1]T %[1]v",
+				multiErr.Errors[i])
+		}
+		if waitErr.Addr != addr {
+			t.Fatalf("expected %v, got %v", addr, waitErr.Addr)
+		}
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Fatal(err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded error, got %v", err)
+	}
+	var waitErr *WaitError
+	if !errors.As(err, &waitErr) || waitErr.Addr != addr1 {
+		t.Fatalf("expected *WaitError of %v, got %v", addr1, waitErr)
+	}
+
+	err = WaitForRedis(WithTimeout(100*time.Millisecond), WithAddrs(addr1))
+	if !errors.As(err, &multiErr) || len(multiErr.Errors) != 1 {
+		t.Fatalf("expected *MultiWaitError, got %[1]T %[1]v", err)
+	}
+
+	err = WaitForRedis(WithAddrs("redis://host:port:port"))
+	if err == nil {
+		t.Fatal("expected error on invalid URL")
+	}
+}
+
+// closedAddr returns address nobody listens on.
+func closedAddr(t testing.TB) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	if err = ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
+
+func TestWaitErrorMessage(t *testing.T) {
+	err := &WaitError{
+		Addr:  ":6379",
+		Phase: WaitPhaseReady,
+		Elapsed: map[string]time.Duration{
+			WaitPhaseDial:  3 * time.Millisecond,
+			WaitPhaseReady: 5 * time.Second,
+		},
+		Attempts: []WaitAttempt{
+			{
+				Phase: WaitPhaseReady,
+				Err:   errors.New("redis is loading dataset"),
+				Info: map[string]string{
+					"loading":             "1",
+					"loading_loaded_perc": "80.00",
+				},
+			},
+		},
+		Err: context.DeadlineExceeded,
+	}
+	want := "wait for :6379 failed in ready phase, dial 3ms, ready 5s, " +
+		"1 attempts, last error: redis is loading dataset " +
+		"loading_loaded_perc=80.00: context deadline exceeded"
+	if err.Error() != want {
+		t.Fatal(err.Error())
+	}
+}
+
 func TestParseInfoResponse(t *testing.T) {
 	in := `
 # Persistence